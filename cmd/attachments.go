@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/derricw/siggo/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	attachmentsCmd.AddCommand(attachmentsGCCmd)
+	rootCmd.AddCommand(attachmentsCmd)
+}
+
+var attachmentsCmd = &cobra.Command{
+	Use:   "attachments",
+	Short: "manage siggo's copies of attachments",
+	Long: `siggo keeps its own copy of every attachment, since signal-cli deletes old ones.
+	example:
+	$ siggo attachments gc`,
+}
+
+var attachmentsGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "remove attachments that saved conversations don't refer to",
+	Long: `Removes attachments that no saved conversation refers to, and any older than
+attachment_max_age_days. If the store is still bigger than attachment_max_store_mb the oldest
+attachments go too. It only runs if you save messages, and not while siggo is running, since
+saved conversations are all it has to go on.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := model.GetConfig()
+		if err != nil {
+			log.Fatalf("failed to read config @ %s", model.ConfigPath())
+		}
+		removed, err := model.CollectAttachments(cfg, time.Now())
+		for _, path := range removed {
+			fmt.Println(path)
+		}
+		if err != nil {
+			log.Fatalf("failed to collect attachments: %v", err)
+		}
+		fmt.Printf("removed %d attachments\n", len(removed))
+	},
+}
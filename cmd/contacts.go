@@ -10,9 +10,22 @@ import (
 )
 
 func init() {
+	contactsCmd.AddCommand(contactsRenameCmd)
+	contactsCmd.AddCommand(contactsBlockCmd)
+	contactsCmd.AddCommand(contactsUnblockCmd)
+	contactsCmd.AddCommand(contactsRemoveCmd)
 	rootCmd.AddCommand(contactsCmd)
 }
 
+// findContact finds a contact or group by name or number, or dies trying
+func findContact(s *model.Siggo, nameOrNumber string) *model.Contact {
+	c, err := s.Contact(nameOrNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return c
+}
+
 var contactsCmd = &cobra.Command{
 	Use:   "contacts",
 	Short: "list contacts for a given user",
@@ -30,7 +43,61 @@ var contactsCmd = &cobra.Command{
 		s := model.NewSiggo(signalAPI, cfg)
 
 		for _, c := range s.Contacts().SortedByName() {
+			if c.IsBlocked() {
+				fmt.Printf("%s - %s (blocked)\n", c.Name, c.Number)
+				continue
+			}
 			fmt.Printf("%s - %s\n", c.Name, c.Number)
 		}
 	},
 }
+
+var contactsRenameCmd = &cobra.Command{
+	Use:   "rename <contact> <name>",
+	Short: "rename a contact",
+	Long: `example:
+	$ siggo contacts rename +1234567890 "John Smith"`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := loadSiggo()
+		if err := s.RenameContact(findContact(s, args[0]), args[1]); err != nil {
+			log.Fatalf("failed to rename contact: %v", err)
+		}
+	},
+}
+
+var contactsBlockCmd = &cobra.Command{
+	Use:   "block <contact or group>",
+	Short: "block a contact or group",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := loadSiggo()
+		if err := s.Block(findContact(s, args[0])); err != nil {
+			log.Fatalf("failed to block: %v", err)
+		}
+	},
+}
+
+var contactsUnblockCmd = &cobra.Command{
+	Use:   "unblock <contact or group>",
+	Short: "unblock a contact or group",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := loadSiggo()
+		if err := s.Unblock(findContact(s, args[0])); err != nil {
+			log.Fatalf("failed to unblock: %v", err)
+		}
+	},
+}
+
+var contactsRemoveCmd = &cobra.Command{
+	Use:   "remove <contact>",
+	Short: "remove a contact",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := loadSiggo()
+		if err := s.RemoveContact(findContact(s, args[0])); err != nil {
+			log.Fatalf("failed to remove contact: %v", err)
+		}
+	},
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/derricw/siggo/model"
-	"github.com/derricw/siggo/signal"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -29,7 +28,7 @@ var convCmd = &cobra.Command{
 			log.Fatalf("no user phone number configured @ %s", model.ConfigPath())
 		}
 
-		var signalAPI model.SignalAPI = signal.NewSignal(cfg.UserNumber)
+		signalAPI := newSignalAPI(cfg)
 		if mock != "" {
 			signalAPI = setupMock(mock, cfg)
 		}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/derricw/siggo/model"
+	"github.com/derricw/siggo/signal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	groupCmd.AddCommand(groupCreateCmd)
+	groupCmd.AddCommand(groupRenameCmd)
+	groupCmd.AddCommand(groupDescribeCmd)
+	groupCmd.AddCommand(groupAvatarCmd)
+	groupCmd.AddCommand(groupAddCmd)
+	groupCmd.AddCommand(groupRemoveCmd)
+	groupCmd.AddCommand(groupAdminCmd)
+	groupCmd.AddCommand(groupUnadminCmd)
+	groupCmd.AddCommand(groupLeaveCmd)
+	rootCmd.AddCommand(groupCmd)
+}
+
+// findGroup finds a group by ID or name
+func findGroup(s *model.Siggo, idOrName string) *model.Contact {
+	group := s.Contacts().Lookup(idOrName)
+	if group == nil || !group.IsGroup() {
+		log.Fatalf("failed to find group: %s", idOrName)
+	}
+	return group
+}
+
+// updateGroup returns a command that applies whatever update `makeUpdate` returns to a group
+func updateGroup(makeUpdate func(s *model.Siggo, args []string) *signal.GroupUpdate) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		s := loadSiggo()
+		group := findGroup(s, args[0])
+		if err := s.UpdateGroup(group, makeUpdate(s, args[1:])); err != nil {
+			log.Fatalf("failed to update group: %v", err)
+		}
+	}
+}
+
+// numbers resolves contact names or numbers, or dies trying
+func numbers(s *model.Siggo, namesOrNumbers []string) []model.PhoneNumber {
+	numbers, err := s.Numbers(namesOrNumbers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return numbers
+}
+
+var groupCmd = &cobra.Command{
+	Use:   "group",
+	Short: "manage groups",
+	Long: `Groups can be referred to by ID or name. Members can be referred to by number or name.
+	example:
+	$ siggo group create "Book Club" +1234567890 "John Smith"
+	$ siggo group rename "Book Club" "Movie Club"
+	$ siggo group leave "Movie Club"`,
+}
+
+var groupCreateCmd = &cobra.Command{
+	Use:   "create <name> [member...]",
+	Short: "create a new group",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := loadSiggo()
+		group, err := s.CreateGroup(args[0], numbers(s, args[1:]))
+		if err != nil {
+			log.Fatalf("failed to create group: %v", err)
+		}
+		fmt.Printf("%s - %s\n", group.Name, group.Number)
+	},
+}
+
+var groupRenameCmd = &cobra.Command{
+	Use:   "rename <group> <name>",
+	Short: "rename a group",
+	Args:  cobra.ExactArgs(2),
+	Run: updateGroup(func(s *model.Siggo, args []string) *signal.GroupUpdate {
+		return &signal.GroupUpdate{Name: args[0]}
+	}),
+}
+
+var groupDescribeCmd = &cobra.Command{
+	Use:   "describe <group> <description>",
+	Short: "set a group's description",
+	Args:  cobra.ExactArgs(2),
+	Run: updateGroup(func(s *model.Siggo, args []string) *signal.GroupUpdate {
+		return &signal.GroupUpdate{Description: args[0]}
+	}),
+}
+
+var groupAvatarCmd = &cobra.Command{
+	Use:   "avatar <group> <image>",
+	Short: "set a group's avatar",
+	Args:  cobra.ExactArgs(2),
+	Run: updateGroup(func(s *model.Siggo, args []string) *signal.GroupUpdate {
+		return &signal.GroupUpdate{Avatar: args[0]}
+	}),
+}
+
+var groupAddCmd = &cobra.Command{
+	Use:   "add <group> <member...>",
+	Short: "add members to a group",
+	Args:  cobra.MinimumNArgs(2),
+	Run: updateGroup(func(s *model.Siggo, args []string) *signal.GroupUpdate {
+		return &signal.GroupUpdate{AddMembers: numbers(s, args)}
+	}),
+}
+
+var groupRemoveCmd = &cobra.Command{
+	Use:   "remove <group> <member...>",
+	Short: "remove members from a group",
+	Args:  cobra.MinimumNArgs(2),
+	Run: updateGroup(func(s *model.Siggo, args []string) *signal.GroupUpdate {
+		return &signal.GroupUpdate{RemoveMembers: numbers(s, args)}
+	}),
+}
+
+var groupAdminCmd = &cobra.Command{
+	Use:   "admin <group> <member...>",
+	Short: "make members admins of a group",
+	Args:  cobra.MinimumNArgs(2),
+	Run: updateGroup(func(s *model.Siggo, args []string) *signal.GroupUpdate {
+		return &signal.GroupUpdate{AddAdmins: numbers(s, args)}
+	}),
+}
+
+var groupUnadminCmd = &cobra.Command{
+	Use:   "unadmin <group> <member...>",
+	Short: "take admin away from members of a group",
+	Args:  cobra.MinimumNArgs(2),
+	Run: updateGroup(func(s *model.Siggo, args []string) *signal.GroupUpdate {
+		return &signal.GroupUpdate{RemoveAdmins: numbers(s, args)}
+	}),
+}
+
+var groupLeaveCmd = &cobra.Command{
+	Use:   "leave <group>",
+	Short: "leave a group",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := loadSiggo()
+		if err := s.LeaveGroup(findGroup(s, args[0])); err != nil {
+			log.Fatalf("failed to leave group: %v", err)
+		}
+	},
+}
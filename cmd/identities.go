@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/derricw/siggo/model"
+	"github.com/derricw/siggo/signal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var trustAll bool
+
+func init() {
+	trustCmd.Flags().BoolVarP(&trustAll, "all", "a", false, "trust every key we know for the contact without verifying it")
+	rootCmd.AddCommand(identitiesCmd)
+	rootCmd.AddCommand(trustCmd)
+}
+
+// printIdentity prints an identity key with its safety number, four groups to a line like
+// signal shows it
+func printIdentity(s *model.Siggo, id *signal.Identity) {
+	name := id.Number
+	if c, ok := s.Contacts()[id.Number]; ok {
+		name = fmt.Sprintf("%s - %s", c.Name, id.Number)
+	}
+	added := time.Unix(0, id.AddedTimestamp*1000000).Format("2006-01-02")
+	fmt.Printf("%s (%s, added %s)\n", name, id.TrustText(), added)
+	groups := id.SafetyNumberGroups()
+	for i := 0; i < len(groups); i += 4 {
+		end := i + 4
+		if end > len(groups) {
+			end = len(groups)
+		}
+		fmt.Printf("\t%s\n", strings.Join(groups[i:end], " "))
+	}
+}
+
+var identitiesCmd = &cobra.Command{
+	Use:   "identities [contact]",
+	Short: "list identity keys and safety numbers",
+	Long: `Lists the identity keys we know, with their safety numbers and whether we trust them.
+example:
+	$ siggo identities
+	$ siggo identities "Ruby Rhod"`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := loadSiggo()
+		var contact *model.Contact
+		if len(args) > 0 {
+			contact = findContact(s, args[0])
+		}
+		identities, err := s.Identities(contact)
+		if err != nil {
+			log.Fatalf("failed to list identities: %v", err)
+		}
+		for _, id := range identities {
+			printIdentity(s, id)
+		}
+	},
+}
+
+var trustCmd = &cobra.Command{
+	Use:   "trust <contact> [safety number]",
+	Short: "trust a contact's identity key",
+	Long: `Verifies a contact's identity key against the safety number you checked with them, or
+trusts every key we know for them with --all.
+example:
+	$ siggo trust "Ruby Rhod" 12345 67890 12345 ...
+	$ siggo trust "Ruby Rhod" --all`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		safetyNumber := strings.Join(args[1:], "")
+		if safetyNumber == "" && !trustAll {
+			log.Fatal("give the safety number you checked with them, or --all")
+		}
+		if safetyNumber != "" && trustAll {
+			log.Fatal("give a safety number or --all, not both")
+		}
+		s := loadSiggo()
+		if err := s.Trust(findContact(s, args[0]), safetyNumber); err != nil {
+			log.Fatalf("failed to trust: %v", err)
+		}
+	},
+}
@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 
-	"github.com/derricw/siggo/model"
 	"github.com/derricw/siggo/signal"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -24,13 +23,9 @@ var linkCmd = &cobra.Command{
 		fmt.Println("linking...")
 		fmt.Println("In the mobile app, go to Settings -> Linked Devices -> Add")
 		sig := signal.NewSignal(args[0])
-		sig.Link(args[1])
-
-		cfg, err := model.GetConfig()
-		if err != nil {
-			log.Fatalf("failed to read config @ %s", model.ConfigPath())
+		if err := sig.Link(args[1]); err != nil {
+			log.Fatalf("failed to link: %s", signal.Describe(err))
 		}
-		cfg.UserNumber = args[0]
-		cfg.Save()
+		saveUserNumber(args[0])
 	},
 }
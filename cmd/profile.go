@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"github.com/derricw/siggo/signal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var profileUpdate signal.ProfileUpdate
+
+func init() {
+	profileCmd.Flags().StringVarP(&profileUpdate.GivenName, "given-name", "n", "", "given (first) name")
+	profileCmd.Flags().StringVarP(&profileUpdate.FamilyName, "family-name", "f", "", "family (last) name")
+	profileCmd.Flags().StringVar(&profileUpdate.About, "about", "", "about text")
+	profileCmd.Flags().StringVar(&profileUpdate.AboutEmoji, "emoji", "", "about emoji")
+	profileCmd.Flags().StringVar(&profileUpdate.Avatar, "avatar", "", "path to an avatar image")
+	profileCmd.Flags().BoolVar(&profileUpdate.RemoveAvatar, "remove-avatar", false, "remove the avatar")
+	rootCmd.AddCommand(profileCmd)
+}
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "update your signal profile",
+	Long: `Sets the name, about text, emoji and avatar that other people see. Anything you don't
+give is left alone. The name is saved as user_name in the config too.
+	example:
+	$ siggo profile --given-name Leeloo --family-name Dallas
+	$ siggo profile --about "multipass" --emoji 🍗 --avatar ~/leeloo.png`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if profileUpdate == (signal.ProfileUpdate{}) {
+			log.Fatal("nothing to update, see 'siggo profile --help'")
+		}
+		if profileUpdate.Avatar != "" && profileUpdate.RemoveAvatar {
+			log.Fatal("give --avatar or --remove-avatar, not both")
+		}
+		s := loadSiggo()
+		if err := s.UpdateProfile(&profileUpdate); err != nil {
+			log.Fatalf("failed to update profile: %v", err)
+		}
+	},
+}
@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"bufio"
+	"os"
+
 	"github.com/derricw/siggo/model"
 	"github.com/derricw/siggo/signal"
 	log "github.com/sirupsen/logrus"
@@ -25,18 +28,36 @@ var receiveCmd = &cobra.Command{
 		if cfg.UserNumber == "" {
 			log.Fatalf("no user phone number configured @ %s", model.ConfigPath())
 		}
+		if err := cfg.NormalizeNumbers(); err != nil {
+			log.Fatal(err)
+		}
+		if err := model.MarkRunning(); err != nil {
+			log.Warnf("failed to write %s: %v", model.PIDPath(), err)
+		}
 
-		var signalAPI model.SignalAPI = signal.NewSignal(cfg.UserNumber)
+		signalAPI := newSignalAPI(cfg)
 		if mock != "" {
 			signalAPI = setupMock(mock, cfg)
 		}
+		startRecording(signalAPI)
 
 		s := model.NewSiggo(signalAPI, cfg)
 
 		s.NewInfo = func(conv *model.Conversation) {
+			if conv == nil {
+				// only the contact list changed
+				return
+			}
 			log.Printf("From: %v | Conv: \n%s", conv.Contact, conv.String())
 		}
 		s.ReceiveForever()
+		if ms, ok := signalAPI.(*signal.MockSignal); ok && step {
+			// next message on enter
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				ms.Step()
+			}
+		}
 		<-make(chan struct{})
 	},
 }
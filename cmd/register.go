@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/derricw/siggo/model"
+	"github.com/derricw/siggo/signal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	voice   bool
+	captcha string
+	pin     string
+)
+
+func init() {
+	registerCmd.Flags().BoolVar(&voice, "voice", false, "get the code by voice call instead of SMS")
+	registerCmd.Flags().StringVar(&captcha, "captcha", "", "captcha token (signalcaptcha://...)")
+	verifyCmd.Flags().StringVar(&pin, "pin", "", "registration lock PIN")
+	rootCmd.AddCommand(registerCmd)
+	rootCmd.AddCommand(verifyCmd)
+}
+
+// saveUserNumber writes a config for `number`, keeping anything already configured
+func saveUserNumber(number string) {
+	cfg, err := model.GetConfig()
+	if err != nil {
+		log.Fatalf("failed to read config @ %s", model.ConfigPath())
+	}
+	cfg.UserNumber = number
+	if err := cfg.Save(); err != nil {
+		log.Fatalf("failed to save config @ %s: %v", model.ConfigPath(), err)
+	}
+}
+
+var registerCmd = &cobra.Command{
+	Use:   "register <phone number>",
+	Short: "register a phone number as a new primary device",
+	Long: `Asks signal to send a verification code by SMS (or voice call with --voice). Finish
+	with 'siggo verify'. Signal usually wants a captcha first, get one from:
+	` + signal.CaptchaURL + `
+	Example:
+	$ siggo register +1234567890 --captcha signalcaptcha://...
+	$ siggo verify +1234567890 123-456`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sig := signal.NewSignal(args[0])
+		if err := sig.Register(voice, captcha); err != nil {
+			log.Fatalf("failed to register %s: %s", args[0], signal.Describe(err))
+		}
+		fmt.Printf("verification code requested, now run:\n  siggo verify %s <code>\n", args[0])
+	},
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify <phone number> <code>",
+	Short: "finish registering with the verification code",
+	Long: `example:
+	$ siggo verify +1234567890 123-456
+	$ siggo verify +1234567890 123-456 --pin 1234`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		sig := signal.NewSignal(args[0])
+		if err := sig.Verify(args[1], pin); err != nil {
+			log.Fatalf("failed to verify %s: %s", args[0], signal.Describe(err))
+		}
+		saveUserNumber(args[0])
+		fmt.Printf("verified! config saved @ %s\n", model.ConfigPath())
+	},
+}
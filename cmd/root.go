@@ -1,15 +1,14 @@
 package cmd
 
 import (
-	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	ossig "os/signal"
 	"path/filepath"
-	"strings"
 	"syscall"
 
+	"github.com/gdamore/tcell"
 	"github.com/rivo/tview"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -20,8 +19,11 @@ import (
 )
 
 var (
-	mock  string
-	debug bool
+	mock   string
+	debug  bool
+	record string
+	speed  float64
+	step   bool
 )
 
 const defaultLogPath = "/tmp/siggo.log"
@@ -29,6 +31,9 @@ const defaultLogPath = "/tmp/siggo.log"
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&mock, "mock", "m", "", "mock mode (uses example data)")
 	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "debug logging")
+	rootCmd.PersistentFlags().StringVar(&record, "record", "", "record everything signal-cli sends us to a file, for use with --mock")
+	rootCmd.PersistentFlags().Float64Var(&speed, "speed", 1, "replay recorded mock data at this speed (0 replays it all at once)")
+	rootCmd.PersistentFlags().BoolVar(&step, "step", false, "replay recorded mock data one message at a time (CTRL+T for the next one)")
 }
 
 func initLogging(cfg *model.Config) {
@@ -57,7 +62,59 @@ func setupMock(mockFileName string, cfg *model.Config) *signal.MockSignal {
 	if err != nil {
 		log.Fatalf("couldn't open mock data: %v %v", mock, err)
 	}
-	return signal.NewMockSignal(cfg.UserNumber, b)
+	ms := signal.NewMockSignal(cfg.UserNumber, b)
+	ms.Replay(signal.ReplayOptions{Speed: speed, Step: step})
+	return ms
+}
+
+var recorder *signal.Recorder
+
+// startRecording makes the backend record what it receives to the file given with --record
+func startRecording(signalAPI model.SignalAPI) {
+	if record == "" {
+		return
+	}
+	r, ok := signalAPI.(interface{ Record(*signal.Recorder) })
+	if !ok {
+		return
+	}
+	if recorder == nil {
+		f, err := os.Create(record)
+		if err != nil {
+			log.Fatalf("couldn't create recording: %v %v", record, err)
+		}
+		recorder = signal.NewRecorder(f)
+	}
+	r.Record(recorder)
+}
+
+// newSignalAPI returns the signal-cli backend selected in the config
+func newSignalAPI(cfg *model.Config) model.SignalAPI {
+	switch cfg.Backend {
+	case model.BackendJSONRPC:
+		return signal.NewJSONRPCSignal(cfg.UserNumber)
+	case model.BackendDbus:
+		return signal.NewDbusSignal(cfg.UserNumber, cfg.DbusSystemBus)
+	case "", model.BackendDaemon:
+	default:
+		log.Warnf("unknown backend '%s', using '%s'", cfg.Backend, model.BackendDaemon)
+	}
+	return signal.NewSignal(cfg.UserNumber)
+}
+
+// loadSiggo sets up a siggo model for subcommands that manage contacts or groups
+func loadSiggo() *model.Siggo {
+	cfg, err := model.GetConfig()
+	if err != nil {
+		log.Fatalf("failed to read config @ %s", model.ConfigPath())
+	}
+	if cfg.UserNumber == "" {
+		log.Fatalf("no user phone number configured @ %s", model.ConfigPath())
+	}
+	if err := cfg.NormalizeNumbers(); err != nil {
+		log.Fatal(err)
+	}
+	return model.NewSiggo(newSignalAPI(cfg), cfg)
 }
 
 func hasSignalCLI() bool {
@@ -79,32 +136,58 @@ var rootCmd = &cobra.Command{
 			log.Fatalf("failed to read config @ %s", model.ConfigPath())
 		}
 
+		if cfg.UserNumber == "" && len(cfg.Accounts) > 0 {
+			cfg.UserNumber = cfg.Accounts[0].Number
+		}
 		if cfg.UserNumber == "" {
 			log.Fatalf("no user phone number configured @ %s", model.ConfigPath())
 		}
-
-		if !strings.HasPrefix(cfg.UserNumber, "+") {
-			cfg.UserNumber = fmt.Sprintf("+%s", cfg.UserNumber)
-		}
-
-		if len(cfg.UserNumber) < 12 {
-			log.Fatalf("user phone number: %s is too short. did you forget a country code?", cfg.UserNumber)
+		if err := cfg.NormalizeNumbers(); err != nil {
+			log.Fatal(err)
 		}
 
 		initLogging(cfg)
-
-		var signalAPI model.SignalAPI = signal.NewSignal(cfg.UserNumber)
-		if mock != "" {
-			signalAPI = setupMock(mock, cfg)
+		if err := model.MarkRunning(); err != nil {
+			log.Warnf("failed to write %s: %v", model.PIDPath(), err)
 		}
-		defer signalAPI.Close()
 
-		s := model.NewSiggo(signalAPI, cfg)
+		accounts := make([]*model.Siggo, 0)
+		mocks := make([]*signal.MockSignal, 0)
+		if len(cfg.AccountList()) > 1 && cfg.Backend != model.BackendJSONRPC {
+			log.Warnf("only the '%s' backend can run more than one account, using it for each account",
+				model.BackendJSONRPC)
+		}
+		for _, account := range cfg.AccountList() {
+			accountCfg := cfg.ForAccount(account)
+			signalAPI := newSignalAPI(accountCfg)
+			if mock != "" {
+				signalAPI = setupMock(mock, accountCfg)
+			}
+			startRecording(signalAPI)
+			defer signalAPI.Close()
+
+			s := model.NewSiggo(signalAPI, accountCfg)
+			s.ReceiveForever()
+			accounts = append(accounts, s)
+			if ms, ok := signalAPI.(*signal.MockSignal); ok {
+				mocks = append(mocks, ms)
+			}
+		}
 
-		s.ReceiveForever()
 		//tview.Styles.PrimitiveBackgroundColor = tcell.ColorDefault
 		app := tview.NewApplication()
-		chatWindow := widgets.NewChatWindow(s, app)
+		chatWindow := widgets.NewChatWindow(accounts, app)
+		if step && len(mocks) > 0 {
+			app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+				if event.Key() != tcell.KeyCtrlT {
+					return event
+				}
+				for _, ms := range mocks {
+					ms.Step()
+				}
+				return nil
+			})
+		}
 
 		// also want to make sure to handle signals
 		sigChan := make(chan os.Signal, 1)
@@ -119,7 +202,6 @@ var rootCmd = &cobra.Command{
 
 		// finally, start the tview app
 		if err := app.SetRoot(chatWindow, true).SetFocus(chatWindow).Run(); err != nil {
-			signalAPI.Close() // redundant?
 			panic(err)
 		}
 		// clean up when we're done
@@ -6,6 +6,7 @@ require (
 	github.com/atotto/clipboard v0.1.2
 	github.com/gdamore/tcell v1.3.0
 	github.com/gen2brain/beeep v0.0.0-20200526185328-e9c15c258e28
+	github.com/godbus/dbus/v5 v5.0.3
 	github.com/kyokomi/emoji v2.2.4+incompatible
 	github.com/mdp/qrterminal/v3 v3.0.0
 	github.com/rivo/tview v0.0.0-20200329194346-7cc182c5846e
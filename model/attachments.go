@@ -0,0 +1,217 @@
+package model
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// incomingPrefix starts the names of attachments that are still being copied into the store
+const incomingPrefix = ".incoming-"
+
+// storeName is the name of our copy of the attachment: its hash, plus an extension so that
+// whatever opens it knows what it is
+func (a *Attachment) storeName() string {
+	ext := filepath.Ext(a.OriginalName)
+	if ext == "" {
+		if exts, err := mime.ExtensionsByType(a.ContentType); err == nil && len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return a.Hash + ext
+}
+
+// store copies the attachment into AttachmentFolder, unless we already have it, and records its
+// hash. View-once media is left where it is, since we delete it once it has been viewed.
+func (a *Attachment) store() error {
+	if a.Hash != "" || a.ViewOnce {
+		return nil
+	}
+	src, err := a.sourcePath()
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	folder := AttachmentFolder()
+	if err := os.MkdirAll(folder, os.ModePerm); err != nil {
+		return err
+	}
+	// copy to a temporary file while we hash, since we don't know the name yet
+	tmp, err := ioutil.TempFile(folder, incomingPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), in)
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+	a.Hash = hex.EncodeToString(hash.Sum(nil))
+	a.OriginalName = filepath.Base(a.Filename)
+	dest := filepath.Join(folder, a.storeName())
+	if _, err := os.Stat(dest); err == nil {
+		// same content as something we already have
+		return nil
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// storeAttachments copies the message's attachments into our store. Attachments we can't copy
+// are left where they are.
+func (m *Message) storeAttachments() {
+	for _, a := range m.Attachments {
+		if err := a.store(); err != nil {
+			log.Warnf("failed to store attachment %s: %v", a.Filename, err)
+		}
+	}
+}
+
+// referencedAttachments returns the name of every stored attachment that a saved conversation
+// refers to, with the timestamp of the latest message that does
+func referencedAttachments(cfg *Config) (map[string]int64, error) {
+	referenced := make(map[string]int64)
+	folders := []string{ConversationFolder()}
+	for _, account := range cfg.AccountList() {
+		folders = append(folders, AccountConversationFolder(account.Number))
+	}
+	for _, folder := range folders {
+		files, err := ioutil.ReadDir(folder)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, info := range files {
+			if info.IsDir() {
+				continue
+			}
+			if err := addReferences(filepath.Join(folder, info.Name()), referenced); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return referenced, nil
+}
+
+// addReferences adds the stored attachments that a saved conversation refers to
+func addReferences(path string, referenced map[string]int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for s.Scan() {
+		msg := &Message{}
+		if err := json.Unmarshal(s.Bytes(), msg); err != nil {
+			return err
+		}
+		for _, a := range msg.Attachments {
+			if a.Hash == "" {
+				continue
+			}
+			name := a.storeName()
+			if a.Timestamp > referenced[name] {
+				referenced[name] = a.Timestamp
+			}
+		}
+	}
+	return s.Err()
+}
+
+// storedFile is a file in the attachment store
+type storedFile struct {
+	name string
+	size int64
+	// lastUsed is the timestamp of the latest message with the attachment (ms since epoch)
+	lastUsed int64
+}
+
+// CollectAttachments removes attachments that no saved conversation refers to from the store. It
+// also removes attachments older than AttachmentMaxAgeDays, then the oldest ones until the store
+// fits in AttachmentMaxStoreMB. Returns the paths of the files it removed.
+//
+// Saved conversations are all we have to go on, so it refuses to run if we don't save messages,
+// or while siggo is running and may have attachments it hasn't saved yet.
+func CollectAttachments(cfg *Config, now time.Time) ([]string, error) {
+	if !cfg.SaveMessages {
+		return nil, fmt.Errorf("save_messages is off, so there is no telling which attachments are in use")
+	}
+	if pid, ok := Running(); ok {
+		return nil, fmt.Errorf("siggo is running (pid %d), quit it first", pid)
+	}
+	referenced, err := referencedAttachments(cfg)
+	if err != nil {
+		return nil, err
+	}
+	folder := AttachmentFolder()
+	files, err := ioutil.ReadDir(folder)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	removed := make([]string, 0)
+	remove := func(name string) error {
+		path := filepath.Join(folder, name)
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed = append(removed, path)
+		return nil
+	}
+	cutoff := int64(0)
+	if cfg.AttachmentMaxAgeDays > 0 {
+		cutoff = now.AddDate(0, 0, -cfg.AttachmentMaxAgeDays).UnixNano() / 1000000
+	}
+	kept := make([]storedFile, 0, len(files))
+	total := int64(0)
+	for _, info := range files {
+		if info.IsDir() || strings.HasPrefix(info.Name(), incomingPrefix) {
+			continue
+		}
+		lastUsed, ok := referenced[info.Name()]
+		if !ok || lastUsed < cutoff {
+			if err := remove(info.Name()); err != nil {
+				return removed, err
+			}
+			continue
+		}
+		kept = append(kept, storedFile{info.Name(), info.Size(), lastUsed})
+		total += info.Size()
+	}
+	if cfg.AttachmentMaxStoreMB <= 0 {
+		return removed, nil
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].lastUsed < kept[j].lastUsed })
+	limit := int64(cfg.AttachmentMaxStoreMB) * 1024 * 1024
+	for _, f := range kept {
+		if total <= limit {
+			break
+		}
+		if err := remove(f.name); err != nil {
+			return removed, err
+		}
+		total -= f.size
+	}
+	return removed, nil
+}
@@ -0,0 +1,120 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/derricw/siggo/signal"
+	log "github.com/sirupsen/logrus"
+)
+
+// call is a call we've been offered and haven't seen the end of. Its entry in the conversation
+// is updated as the call goes on.
+type call struct {
+	entry    *Message
+	conv     *Conversation
+	from     *Contact
+	video    bool
+	answered bool
+}
+
+// describe sets the text of the call's entry, like "📞 missed voice call from Bob at 14:03"
+func (c *call) describe(what string) {
+	kind := "voice call"
+	if c.video {
+		kind = "video call"
+	}
+	at := time.Unix(0, c.entry.Timestamp*1000000).Format("15:04")
+	c.conv.messageLock.Lock()
+	c.entry.Content = fmt.Sprintf("📞 %s %s from %s at %s", what, kind, c.from, at)
+	c.conv.hasNewData = true
+	c.conv.messageLock.Unlock()
+}
+
+// onCall keeps track of calls, adding an entry to the conversation when someone calls us and
+// updating it once we know whether we picked up. Calls are answered on the phone, so all we can
+// do is let the user know.
+func (s *Siggo) onCall(msg *signal.Message) error {
+	callMsg := msg.Envelope.CallMessage
+	switch {
+	case callMsg.OfferMessage != nil:
+		return s.onCallOffer(msg)
+	case callMsg.AnswerMessage != nil:
+		s.onCallAnswered(callMsg.AnswerMessage.ID)
+	case callMsg.BusyMessage != nil:
+		s.onCallEnded(callMsg.BusyMessage.ID, "missed")
+	case callMsg.HangupMessage != nil:
+		hangup := callMsg.HangupMessage
+		switch hangup.Type {
+		case signal.HangupAccepted:
+			// one of our other devices picked up
+			s.onCallAnswered(hangup.ID)
+		case signal.HangupDeclined:
+			s.onCallEnded(hangup.ID, "declined")
+		default:
+			s.onCallEnded(hangup.ID, "missed")
+		}
+	}
+	return nil
+}
+
+// onCallOffer adds an entry for an incoming call and notifies us about it
+func (s *Siggo) onCallOffer(msg *signal.Message) error {
+	offer := msg.Envelope.CallMessage.OfferMessage
+	if msg.Envelope.Source == s.config.UserNumber {
+		// we are calling someone from our phone
+		return nil
+	}
+	if _, ok := s.calls[offer.ID]; ok {
+		// offers are sent to each of our devices, but one entry is plenty
+		return nil
+	}
+	c := s.contactFor(msg.Envelope.Source)
+	conv := s.conversationFor(c)
+	incoming := &call{
+		entry: &Message{
+			From:        c.String(),
+			Timestamp:   msg.Envelope.Timestamp,
+			IsDelivered: true,
+			FromContact: c,
+			Kind:        SystemMessage,
+		},
+		conv:  conv,
+		from:  c,
+		video: offer.Type == signal.VideoCall,
+	}
+	s.calls[offer.ID] = incoming
+	incoming.describe("incoming")
+	conv.AddMessage(incoming.entry)
+	log.Infof("incoming call from: %v", c)
+	s.NewInfo(conv)
+	s.sendNotification(c.String(), incoming.entry.Content, c.Avatar())
+	return nil
+}
+
+// onCallAnswered records that we picked up a call
+func (s *Siggo) onCallAnswered(ID int64) {
+	incoming, ok := s.calls[ID]
+	if !ok {
+		return
+	}
+	incoming.answered = true
+	incoming.describe("answered")
+	s.NewInfo(incoming.conv)
+}
+
+// onCallEnded forgets a call once it is over. If we never picked up, its entry says how it
+// ended.
+func (s *Siggo) onCallEnded(ID int64, how string) {
+	incoming, ok := s.calls[ID]
+	if !ok {
+		return
+	}
+	delete(s.calls, ID)
+	if incoming.answered {
+		return
+	}
+	incoming.describe(how)
+	log.Infof("%s call from: %v", how, incoming.from)
+	s.NewInfo(incoming.conv)
+}
@@ -6,10 +6,28 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
 
+// Backends that siggo can use to talk to signal-cli. See Config.Backend
+const (
+	// BackendDaemon runs `signal-cli daemon` and sends through it with `signal-cli --dbus`
+	BackendDaemon = "daemon"
+	// BackendJSONRPC keeps a single `signal-cli jsonRpc` process running for everything
+	BackendJSONRPC = "jsonrpc"
+	// BackendDbus talks to `signal-cli daemon` directly over D-Bus
+	BackendDbus = "dbus"
+)
+
+const (
+	// BlockedDrop throws away messages from blocked contacts
+	BlockedDrop = "drop"
+	// BlockedQuarantine keeps messages from blocked contacts, but doesn't notify us about them
+	BlockedQuarantine = "quarantine"
+)
+
 var (
 	configFilename   string = "config.yml"
 	configFolderName string = "siggo"
@@ -41,11 +59,29 @@ func FindDataFolder() string {
 	return filepath.Join(d, ".local", "share", dataFolderName)
 }
 
-// ConversationFolder returns the folder where conversations are saved
+// ConversationFolder returns the folder where conversations used to be saved, before siggo
+// supported more than one account. See AccountConversationFolder.
 func ConversationFolder() string {
 	return filepath.Join(FindDataFolder(), "conversations")
 }
 
+// AccountConversationFolder returns the folder where conversations are saved for an account
+func AccountConversationFolder(number string) string {
+	return filepath.Join(FindDataFolder(), "accounts", number, "conversations")
+}
+
+// AccountOutboxPath returns the file where we keep messages for an account that haven't been sent
+// yet
+func AccountOutboxPath(number string) string {
+	return filepath.Join(FindDataFolder(), "accounts", number, "outbox.json")
+}
+
+// AttachmentFolder returns the folder where we keep our own copy of attachments, shared by all
+// accounts. Files are named after the hash of their content.
+func AttachmentFolder() string {
+	return filepath.Join(FindDataFolder(), "attachments")
+}
+
 // LogPath returns the log file path
 func LogPath() string {
 	return filepath.Join(FindDataFolder(), "siggo.log")
@@ -56,13 +92,39 @@ func DefaultConfig() *Config {
 		UserName:       "self",
 		ContactColors:  make(map[string]string),
 		ContactAliases: make(map[string]string),
+		QuietGroups:    make([]string, 0),
+		Accounts:       make([]Account, 0),
+
+		ReadReceiptOverrides: make(map[string]bool),
 	}
 }
 
+// Account is one of the signal accounts we run
+type Account struct {
+	Number string `yaml:"number"`
+	// Name is shown in the account switcher instead of the number
+	Name string `yaml:"name"`
+}
+
+// String returns the name of the account, or its number if it doesn't have one
+func (a Account) String() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return a.Number
+}
+
 // Config includes both siggo and UI config
 type Config struct {
 	UserNumber string `yaml:"user_number"`
 	UserName   string `yaml:"user_name"`
+	// Accounts are more numbers to run alongside UserNumber. UserNumber can be listed too, to
+	// give it a name.
+	Accounts []Account `yaml:"accounts"`
+	// Backend selects how we talk to signal-cli. One of "daemon" (default), "jsonrpc" or "dbus".
+	Backend string `yaml:"backend"`
+	// DbusSystemBus makes the "dbus" backend use the system bus instead of the session bus
+	DbusSystemBus bool `yaml:"dbus_system_bus"`
 	// SaveMessages enables message saving. You will still load any (previously) saved messages
 	// at startup.
 	SaveMessages bool `yaml:"save_messages"`
@@ -72,6 +134,27 @@ type Config struct {
 	DesktopNotificationsShowAvatar  bool `yaml:"desktop_notifications_show_avatar"`
 	// Terminal bell
 	TerminalBellNotifications bool `yaml:"terminal_bell_notifications"`
+	// DisableTypingIndicators stops us from telling people when we are typing. We still show when
+	// they are.
+	DisableTypingIndicators bool `yaml:"disable_typing_indicators"`
+	// QuietGroups are groups (by name or ID) that don't notify us unless we are mentioned
+	QuietGroups []string `yaml:"quiet_groups"`
+	// SendReadReceipts tells people when we've read their messages
+	SendReadReceipts bool `yaml:"send_read_receipts"`
+	// ReadReceiptOverrides turns read receipts on or off for specific contacts (by name or number),
+	// whatever SendReadReceipts says
+	ReadReceiptOverrides map[string]bool `yaml:"read_receipt_overrides"`
+	// BlockedMessages is what we do with messages from blocked contacts and groups. One of
+	// "drop" (default) or "quarantine", which keeps them without notifying us.
+	BlockedMessages string `yaml:"blocked_messages"`
+	// ShowBlocked shows blocked contacts and groups in the contact list
+	ShowBlocked bool `yaml:"show_blocked"`
+	// AttachmentMaxAgeDays is how long `siggo attachments gc` keeps attachments, even if saved
+	// conversations still refer to them. 0 keeps them forever.
+	AttachmentMaxAgeDays int `yaml:"attachment_max_age_days"`
+	// AttachmentMaxStoreMB is how big the attachment store can get before `siggo attachments gc`
+	// removes the oldest attachments. 0 means no limit.
+	AttachmentMaxStoreMB int `yaml:"attachment_max_store_mb"`
 	// doesn't do anything yet
 	MaxConversationLength int               `yaml:"max_coversation_length"`
 	HidePanelTitles       bool              `yaml:"hide_panel_titles"`
@@ -81,6 +164,82 @@ type Config struct {
 
 	// No rotation provided, use at your own risk!
 	LogFilePath string `yaml:"log_file"`
+
+	// account is the account this copy of the config is for, see ForAccount
+	account Account
+}
+
+// NormalizeNumbers adds the "+" that UserNumber and the account numbers may be missing, so that
+// the same number is always spelled the same way, and checks that they have a country code
+func (c *Config) NormalizeNumbers() error {
+	number, err := normalizeNumber(c.UserNumber)
+	if err != nil {
+		return err
+	}
+	c.UserNumber = number
+	for i := range c.Accounts {
+		if c.Accounts[i].Number, err = normalizeNumber(c.Accounts[i].Number); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func normalizeNumber(number string) (string, error) {
+	if number == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(number, "+") {
+		number = "+" + number
+	}
+	if len(number) < 12 {
+		return "", fmt.Errorf("user phone number: %s is too short. did you forget a country code?", number)
+	}
+	return number, nil
+}
+
+// AccountList returns every account we should run, starting with UserNumber
+func (c *Config) AccountList() []Account {
+	accounts := make([]Account, 0, len(c.Accounts)+1)
+	seen := make(map[string]bool)
+	primary := Account{Number: c.UserNumber}
+	for _, a := range c.Accounts {
+		if a.Number == c.UserNumber {
+			primary = a
+		}
+	}
+	for _, a := range append([]Account{primary}, c.Accounts...) {
+		if a.Number == "" || seen[a.Number] {
+			continue
+		}
+		seen[a.Number] = true
+		accounts = append(accounts, a)
+	}
+	return accounts
+}
+
+// ForAccount returns a copy of the config for one of our accounts. UserName belongs to
+// UserNumber, so the other accounts don't have one. The daemon and dbus backends all claim the
+// same bus name, so when we run more than one account, each gets its own jsonrpc backend instead.
+func (c *Config) ForAccount(account Account) *Config {
+	cfg := *c
+	cfg.UserNumber = account.Number
+	cfg.account = account
+	if account.Number != c.UserNumber {
+		cfg.UserName = ""
+	}
+	if len(c.AccountList()) > 1 {
+		cfg.Backend = BackendJSONRPC
+	}
+	return &cfg
+}
+
+// Account returns the account this config is for
+func (c *Config) Account() Account {
+	if c.account.Number == "" {
+		return Account{Number: c.UserNumber}
+	}
+	return c.account
 }
 
 // SaveAs writes the config to `path`
@@ -103,6 +262,20 @@ func (c *Config) Save() error {
 	return c.SaveAs(ConfigPath())
 }
 
+// SaveUserName saves `name` as the UserName in the config file, if `number` is the account it
+// belongs to
+func SaveUserName(number, name string) error {
+	cfg, err := GetConfig()
+	if err != nil {
+		return err
+	}
+	if primary, _ := normalizeNumber(cfg.UserNumber); primary != number || cfg.UserName == name {
+		return nil
+	}
+	cfg.UserName = name
+	return cfg.Save()
+}
+
 // Print pretty-prints the configuration
 func (c *Config) Print() {
 	b, _ := yaml.Marshal(c)
@@ -22,3 +22,52 @@ func TestConfig(t *testing.T) {
 
 	assert.Equal(t, loaded, cfg)
 }
+
+func TestAccountList(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.UserNumber = "+15555555550"
+	cfg.Accounts = []Account{
+		{Number: "+15555555559", Name: "work"},
+		{Number: "+15555555550", Name: "personal"},
+	}
+	accounts := cfg.AccountList()
+	assert.Equal(t, []Account{
+		{Number: "+15555555550", Name: "personal"},
+		{Number: "+15555555559", Name: "work"},
+	}, accounts)
+
+	cfg.UserName = "me"
+	cfg.Backend = BackendDaemon
+	personal := cfg.ForAccount(accounts[0])
+	assert.Equal(t, "me", personal.UserName)
+	assert.Equal(t, BackendJSONRPC, personal.Backend)
+	work := cfg.ForAccount(accounts[1])
+	assert.Equal(t, "+15555555559", work.UserNumber)
+	assert.Equal(t, "work", work.Account().String())
+	assert.Equal(t, "", work.UserName)
+	assert.Equal(t, BackendJSONRPC, work.Backend)
+	assert.Equal(t, "+15555555550", cfg.UserNumber)
+	assert.Equal(t, "+15555555550", cfg.Account().String())
+	assert.Equal(t, "me", cfg.UserName)
+	assert.Equal(t, BackendDaemon, cfg.Backend)
+
+	// one account keeps the backend it asked for
+	cfg.Accounts = nil
+	assert.Equal(t, BackendDaemon, cfg.ForAccount(cfg.AccountList()[0]).Backend)
+}
+
+func TestNormalizeNumbers(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.UserNumber = "15555555550"
+	cfg.UserName = "me"
+	cfg.Accounts = []Account{{Number: "+15555555550", Name: "personal"}, {Number: "15555555559"}}
+	assert.NoError(t, cfg.NormalizeNumbers())
+	assert.Equal(t, "+15555555550", cfg.UserNumber)
+	// the same number with and without "+" is one account
+	accounts := cfg.AccountList()
+	assert.Equal(t, []Account{{Number: "+15555555550", Name: "personal"}, {Number: "+15555555559"}}, accounts)
+	assert.Equal(t, "me", cfg.ForAccount(accounts[0]).UserName)
+
+	cfg.Accounts = []Account{{Number: "5555"}}
+	assert.Error(t, cfg.NormalizeNumbers())
+}
@@ -0,0 +1,165 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/derricw/siggo/signal"
+	log "github.com/sirupsen/logrus"
+)
+
+// Contact finds a contact or group by name or number. Numbers we haven't seen before get a new
+// contact.
+func (s *Siggo) Contact(nameOrNumber string) (*Contact, error) {
+	if c := s.lookup(nameOrNumber); c != nil {
+		return c, nil
+	}
+	if !strings.HasPrefix(nameOrNumber, "+") {
+		return nil, fmt.Errorf("unknown contact: %s", nameOrNumber)
+	}
+	c := s.contactFor(nameOrNumber)
+	s.conversationFor(c)
+	return c, nil
+}
+
+// RenameContact changes the name we have for a contact
+func (s *Siggo) RenameContact(contact *Contact, name string) error {
+	if contact.isGroup {
+		return s.UpdateGroup(contact, &signal.GroupUpdate{Name: name})
+	}
+	if err := s.signal.UpdateContact(contact.Number, name); err != nil {
+		return err
+	}
+	contact.Name = name
+	s.NewInfo(s.conversationFor(contact))
+	return nil
+}
+
+// RemoveContact forgets a contact. Its saved conversation is left alone.
+func (s *Siggo) RemoveContact(contact *Contact) error {
+	if contact.isGroup {
+		return fmt.Errorf("%v is a group, leave it instead", contact)
+	}
+	if err := s.signal.RemoveContact(contact.Number); err != nil {
+		return err
+	}
+	s.contactsLock.Lock()
+	delete(s.contacts, contact.Number)
+	s.contactsLock.Unlock()
+	s.conversationsLock.Lock()
+	delete(s.conversations, contact)
+	s.conversationsLock.Unlock()
+	log.Infof("removed contact: %v", contact)
+	return nil
+}
+
+// Block stops messages from a contact or group
+func (s *Siggo) Block(contact *Contact) error {
+	if err := s.signal.Block(contact.Number, contact.isGroup); err != nil {
+		return err
+	}
+	contact.blocked = true
+	log.Infof("blocked: %v", contact)
+	s.NewInfo(s.conversationFor(contact))
+	return nil
+}
+
+// Unblock lets messages from a contact or group through again
+func (s *Siggo) Unblock(contact *Contact) error {
+	if err := s.signal.Unblock(contact.Number, contact.isGroup); err != nil {
+		return err
+	}
+	contact.blocked = false
+	log.Infof("unblocked: %v", contact)
+	s.NewInfo(s.conversationFor(contact))
+	return nil
+}
+
+// Identities lists the identity keys we know for a contact, or for everybody if contact is nil
+func (s *Siggo) Identities(contact *Contact) ([]*signal.Identity, error) {
+	if contact == nil {
+		return s.signal.ListIdentities("")
+	}
+	if contact.isGroup {
+		return nil, fmt.Errorf("%v is a group, check its members instead", contact)
+	}
+	return s.signal.ListIdentities(contact.Number)
+}
+
+// Trust verifies a contact's identity key against the safety number we got from them. With no
+// safety number, every key we know for them is trusted without verifying it.
+func (s *Siggo) Trust(contact *Contact, safetyNumber string) error {
+	if contact.isGroup {
+		return fmt.Errorf("%v is a group, trust its members instead", contact)
+	}
+	safetyNumber = strings.Join(strings.Fields(safetyNumber), "")
+	if err := s.signal.Trust(contact.Number, safetyNumber); err != nil {
+		return err
+	}
+	if safetyNumber == "" {
+		log.Infof("trusted all known keys for: %v", contact)
+	} else {
+		log.Infof("verified: %v", contact)
+	}
+	return nil
+}
+
+// isBlocked returns true if a message comes from a blocked contact or was sent to a blocked group
+func (s *Siggo) isBlocked(msg *signal.Message) bool {
+	if c, ok := s.contact(msg.Envelope.Source); ok && c.blocked {
+		return true
+	}
+	groupID := ""
+	if msg.Envelope.DataMessage != nil && msg.Envelope.DataMessage.GroupInfo != nil {
+		groupID = msg.Envelope.DataMessage.GroupInfo.GroupID
+	} else if edit := msg.Envelope.EditMessage; edit != nil && edit.DataMessage != nil && edit.DataMessage.GroupInfo != nil {
+		groupID = edit.DataMessage.GroupInfo.GroupID
+	} else if msg.Envelope.TypingMessage != nil {
+		groupID = msg.Envelope.TypingMessage.GroupID
+	}
+	g, ok := s.contact(groupID)
+	return ok && g.blocked
+}
+
+// unlessBlocked wraps a callback so that it doesn't see messages from blocked contacts or
+// groups. Depending on the config, their messages are either dropped or quarantined.
+func (s *Siggo) unlessBlocked(cb func(*signal.Message) error) func(*signal.Message) error {
+	return func(msg *signal.Message) error {
+		if !s.isBlocked(msg) {
+			return cb(msg)
+		}
+		if s.config.BlockedMessages == BlockedQuarantine && msg.Envelope.DataMessage != nil {
+			return s.quarantine(msg)
+		}
+		log.Debugf("dropping message from blocked sender: %s", msg.Envelope.Source)
+		return nil
+	}
+}
+
+// quarantine keeps a message from a blocked contact or group, without notifying us or marking
+// the conversation unread. Only plain messages are kept.
+func (s *Siggo) quarantine(msg *signal.Message) error {
+	dataMsg := msg.Envelope.DataMessage
+	if dataMsg.Reaction != nil || dataMsg.RemoteDelete != nil || dataMsg.IsExpirationUpdate {
+		return nil
+	}
+	c := s.contactFor(msg.Envelope.Source)
+	conv := s.conversationFor(c)
+	if dataMsg.GroupInfo != nil {
+		conv = s.conversationFor(s.groupFor(dataMsg.GroupInfo))
+	}
+	hadNewMessage := conv.HasNewMessage
+	conv.AddMessage(&Message{
+		Content:     dataMsg.Message,
+		From:        c.String(),
+		Timestamp:   dataMsg.Timestamp,
+		IsDelivered: true,
+		IsRead:      true,
+		Attachments: ConvertAttachments(dataMsg.Attachments, dataMsg.Timestamp, false),
+		FromContact: c,
+	})
+	conv.HasNewMessage = hadNewMessage
+	log.Infof("quarantined message from blocked sender: %v", c)
+	s.NewInfo(conv)
+	return nil
+}
@@ -0,0 +1,148 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/derricw/siggo/signal"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxEditAge is how long after sending a message we can still edit it. Signal ignores edits of
+// older messages.
+const maxEditAge = 24 * time.Hour
+
+// Edit is an earlier version of an edited message
+type Edit struct {
+	Content string `json:"content"`
+	// Timestamp is when this version was sent (ms since epoch)
+	Timestamp int64 `json:"timestamp"`
+}
+
+// edit replaces the content of the message with a new version sent at `timestamp`, keeping the
+// old one in Edits
+func (m *Message) edit(content string, mentions []*Mention, timestamp int64) {
+	previous := m.EditedAt
+	if previous == 0 {
+		previous = m.Timestamp
+	}
+	m.Edits = append(m.Edits, &Edit{Content: m.Content, Timestamp: previous})
+	m.Content = content
+	m.Mentions = mentions
+	m.EditedAt = timestamp
+}
+
+// CanEdit returns true if the message is one of ours that we can still edit at `now`
+func (m *Message) CanEdit(now time.Time) bool {
+	if !m.FromSelf || m.IsDeleted || m.Kind != "" || m.SendState != "" || m.Sticker != nil {
+		return false
+	}
+	sent := time.Unix(0, m.Timestamp*1000000)
+	return now.Sub(sent) < maxEditAge
+}
+
+// editTarget finds the message an edit refers to. Edits usually target the original message, but
+// we also accept the timestamp of its latest version.
+func (c *Conversation) editTarget(timestamp int64) (*Message, bool) {
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
+	if message, ok := c.Messages[timestamp]; ok {
+		return message, true
+	}
+	for _, message := range c.Messages {
+		if message.EditedAt == timestamp {
+			return message, true
+		}
+	}
+	return nil, false
+}
+
+// editMessage applies a new version of a message in `conv`
+func (s *Siggo) editMessage(conv *Conversation, message *Message, content string, mentions []*Mention, timestamp int64) {
+	conv.messageLock.Lock()
+	message.edit(content, mentions, timestamp)
+	conv.hasNewData = true
+	conv.messageLock.Unlock()
+	s.NewInfo(conv)
+}
+
+// Edit replaces the content of one of our messages in the conversation with `contact`
+func (s *Siggo) Edit(contact *Contact, message *Message, content string) error {
+	if !message.FromSelf {
+		return fmt.Errorf("can only edit our own messages")
+	}
+	if !message.CanEdit(time.Now()) {
+		return fmt.Errorf("can only edit messages we've sent in the last %v", maxEditAge)
+	}
+	opts := &signal.SendOptions{EditTimestamp: message.Timestamp}
+	var mentions []*Mention
+	if contact.isGroup {
+		opts.Mentions, mentions = s.findMentions(content, contact)
+	}
+	conv := s.conversationFor(contact)
+	ID, err := s.signal.SendMessage(contact.Number, contact.isGroup, content, opts)
+	if err != nil {
+		// keep the edit staged, with what we wrote, so that it can be sent again
+		conv.StagedMessage = content
+		return err
+	}
+	conv.ClearStaged()
+	s.editMessage(conv, message, content, mentions, ID)
+	log.Infof("edited message %d: %s", message.Timestamp, content)
+	return nil
+}
+
+// onEdit handles someone editing a message they sent us
+func (s *Siggo) onEdit(msg *signal.Message) error {
+	editMsg := msg.Envelope.EditMessage
+	dataMsg := editMsg.DataMessage
+	if dataMsg == nil {
+		return nil
+	}
+	c := s.contactFor(msg.Envelope.Source)
+	conv := s.conversationFor(c)
+	if dataMsg.GroupInfo != nil {
+		conv = s.conversationFor(s.groupFor(dataMsg.GroupInfo))
+	}
+	message, ok := conv.editTarget(editMsg.TargetSentTimestamp)
+	if !ok {
+		// we missed the original, so the new version is all we get
+		log.Infof("edit of message we don't have: %d", editMsg.TargetSentTimestamp)
+		msg.Envelope.DataMessage = dataMsg
+		return s.onReceived(msg)
+	}
+	// people can only edit their own messages
+	if message.FromSelf || message.FromContact == nil || message.FromContact.Number != c.Number {
+		log.Warnf("%v tried to edit a message they didn't send: %d", c, message.Timestamp)
+		return nil
+	}
+	content, mentions := s.convertMentions(dataMsg.Message, dataMsg.Mentions)
+	s.editMessage(conv, message, content, mentions, dataMsg.Timestamp)
+	return nil
+}
+
+// onEditSent handles us editing a message from another device
+func (s *Siggo) onEditSent(msg *signal.Message) error {
+	sentMsg := msg.Envelope.SyncMessage.SentMessage
+	editMsg := sentMsg.EditMessage
+	dataMsg := editMsg.DataMessage
+	if dataMsg == nil {
+		return nil
+	}
+	var conv *Conversation
+	if dataMsg.GroupInfo != nil {
+		conv = s.conversationFor(s.groupFor(dataMsg.GroupInfo))
+	} else if sentMsg.GroupInfo != nil {
+		conv = s.conversationFor(s.groupFor(sentMsg.GroupInfo))
+	} else {
+		conv = s.conversationFor(s.contactFor(sentMsg.Destination))
+	}
+	message, ok := conv.editTarget(editMsg.TargetSentTimestamp)
+	if !ok || !message.FromSelf {
+		log.Warnf("edit of message we didn't send: %d", editMsg.TargetSentTimestamp)
+		return nil
+	}
+	content, mentions := s.convertMentions(dataMsg.Message, dataMsg.Mentions)
+	s.editMessage(conv, message, content, mentions, dataMsg.Timestamp)
+	return nil
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/derricw/siggo/signal"
+	log "github.com/sirupsen/logrus"
+)
+
+// Numbers resolves contact names (or numbers) to numbers. Anything that isn't a contact we know
+// has to look like a phone number.
+func (s *Siggo) Numbers(namesOrNumbers []string) ([]PhoneNumber, error) {
+	numbers := make([]PhoneNumber, 0, len(namesOrNumbers))
+	for _, n := range namesOrNumbers {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		if c := s.lookup(n); c != nil && !c.isGroup {
+			numbers = append(numbers, c.Number)
+		} else if strings.HasPrefix(n, "+") {
+			numbers = append(numbers, n)
+		} else {
+			return nil, fmt.Errorf("unknown contact: %s", n)
+		}
+	}
+	return numbers, nil
+}
+
+// CreateGroup creates a new group with `members` and adds it to the contact list
+func (s *Siggo) CreateGroup(name string, members []PhoneNumber) (*Contact, error) {
+	groupID, err := s.signal.UpdateGroup("", &signal.GroupUpdate{
+		Name:       name,
+		AddMembers: members,
+	})
+	if err != nil {
+		return nil, err
+	}
+	group := &Contact{
+		Number:  groupID,
+		Name:    name,
+		isGroup: true,
+	}
+	group.Configure(s.config)
+	s.addMembers(group, members...)
+	s.contactsLock.Lock()
+	highestIndex := 0
+	for _, c := range s.contacts {
+		if c.Index > highestIndex {
+			highestIndex = c.Index
+		}
+	}
+	group.Index = highestIndex + 1
+	s.contacts[groupID] = group
+	s.contactsLock.Unlock()
+	conv := s.conversationFor(group)
+	log.Infof("created group: %v", group)
+	s.NewInfo(conv)
+	return group, nil
+}
+
+// UpdateGroup changes a group and updates its contact to match
+func (s *Siggo) UpdateGroup(group *Contact, update *signal.GroupUpdate) error {
+	if !group.isGroup {
+		return fmt.Errorf("%v is not a group", group)
+	}
+	if _, err := s.signal.UpdateGroup(group.Number, update); err != nil {
+		return err
+	}
+	if update.Name != "" {
+		group.Name = update.Name
+	}
+	s.addMembers(group, update.AddMembers...)
+	s.removeMembers(group, update.RemoveMembers...)
+	s.NewInfo(s.conversationFor(group))
+	return nil
+}
+
+// LeaveGroup leaves a group and removes it from the contact list. Its saved conversation is
+// left alone.
+func (s *Siggo) LeaveGroup(group *Contact) error {
+	if !group.isGroup {
+		return fmt.Errorf("%v is not a group", group)
+	}
+	if err := s.signal.QuitGroup(group.Number); err != nil {
+		return err
+	}
+	s.contactsLock.Lock()
+	delete(s.contacts, group.Number)
+	s.contactsLock.Unlock()
+	s.conversationsLock.Lock()
+	delete(s.conversations, group)
+	s.conversationsLock.Unlock()
+	log.Infof("left group: %v", group)
+	s.NewInfo(nil)
+	return nil
+}
+
+// removeMembers forgets that `numbers` are in `group`
+func (s *Siggo) removeMembers(group *Contact, numbers ...PhoneNumber) {
+	for _, number := range numbers {
+		for i, member := range group.members {
+			if member == number {
+				group.members = append(group.members[:i], group.members[i+1:]...)
+				break
+			}
+		}
+	}
+}
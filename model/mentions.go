@@ -0,0 +1,181 @@
+package model
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/derricw/siggo/signal"
+)
+
+// Mention is someone mentioned in a group message. Mentions are rendered into the message
+// content as "@Name", at Start and Length, which are byte offsets into the content.
+type Mention struct {
+	Number PhoneNumber `json:"number"`
+	Name   string      `json:"name"`
+	Start  int         `json:"start"`
+	Length int         `json:"length"`
+}
+
+// utf16Len returns the length of `s` in UTF-16 code units, which is how signal measures
+// mention ranges
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// mentionTag returns the name we show for a mention. We prefer our own name for the contact
+// over whatever signal-cli tells us.
+func (s *Siggo) mentionTag(m *signal.Mention) (PhoneNumber, string) {
+	if m.Number == s.config.UserNumber {
+		return m.Number, s.selfName()
+	}
+	c, _ := s.contact(m.Number)
+	if c == nil && m.UUID != "" {
+		c = s.findByUUID(m.UUID)
+	}
+	switch {
+	case c != nil && c.Number == s.config.UserNumber:
+		return c.Number, s.selfName()
+	case c != nil:
+		return c.Number, c.String()
+	case m.Name != "":
+		return m.Number, m.Name
+	case m.Number != "":
+		return m.Number, m.Number
+	}
+	return m.UUID, m.UUID
+}
+
+// selfName is what we call ourselves: UserName, or our number if we haven't set a name
+func (s *Siggo) selfName() string {
+	if s.config.UserName != "" {
+		return s.config.UserName
+	}
+	return s.config.UserNumber
+}
+
+// convertMentions replaces the mention placeholders in `text` with "@Name"
+func (s *Siggo) convertMentions(text string, wire []*signal.Mention) (string, []*Mention) {
+	if len(wire) == 0 {
+		return text, nil
+	}
+	sorted := make([]*signal.Mention, len(wire))
+	copy(sorted, wire)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	units := utf16.Encode([]rune(text))
+	out := strings.Builder{}
+	mentions := make([]*Mention, 0, len(sorted))
+	pos := 0
+	for _, m := range sorted {
+		if m.Start < pos || m.Start+m.Length > len(units) {
+			// overlapping or out of range, don't trust it
+			continue
+		}
+		number, name := s.mentionTag(m)
+		out.WriteString(string(utf16.Decode(units[pos:m.Start])))
+		mention := &Mention{Number: number, Name: name, Start: out.Len(), Length: len("@" + name)}
+		out.WriteString("@" + name)
+		mentions = append(mentions, mention)
+		pos = m.Start + m.Length
+	}
+	out.WriteString(string(utf16.Decode(units[pos:])))
+	return out.String(), mentions
+}
+
+// mentionsUs returns whether we are one of the mentions
+func (s *Siggo) mentionsUs(mentions []*Mention) bool {
+	for _, m := range mentions {
+		if m.Number == s.config.UserNumber {
+			return true
+		}
+	}
+	return false
+}
+
+// findMentions finds "@Name" for any member of `group` in a message we are about to send
+func (s *Siggo) findMentions(msg string, group *Contact) ([]*signal.Mention, []*Mention) {
+	members := s.GroupMembers(group)
+	// longest names first, so "@Ruby Rhod" wins over "@Ruby"
+	sort.Slice(members, func(i, j int) bool {
+		return len(members[i].String()) > len(members[j].String())
+	})
+	type span struct{ start, end int }
+	taken := make([]span, 0)
+	overlaps := func(start, end int) bool {
+		for _, t := range taken {
+			if start < t.end && t.start < end {
+				return true
+			}
+		}
+		return false
+	}
+	found := make([]*signal.Mention, 0)
+	mentions := make([]*Mention, 0)
+	for _, member := range members {
+		tag := "@" + member.String()
+		for offset := 0; offset < len(msg); {
+			i := strings.Index(msg[offset:], tag)
+			if i < 0 {
+				break
+			}
+			start, end := offset+i, offset+i+len(tag)
+			offset = end
+			if overlaps(start, end) {
+				continue
+			}
+			taken = append(taken, span{start, end})
+			found = append(found, &signal.Mention{
+				Number: member.Number,
+				Start:  utf16Len(msg[:start]),
+				Length: utf16Len(tag),
+			})
+			mentions = append(mentions, &Mention{
+				Number: member.Number,
+				Name:   member.String(),
+				Start:  start,
+				Length: len(tag),
+			})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Start < found[j].Start })
+	sort.Slice(mentions, func(i, j int) bool { return mentions[i].Start < mentions[j].Start })
+	return found, mentions
+}
+
+// GroupMembers returns the contacts in a group, not including us. Members we don't have a
+// contact for are just their number.
+func (s *Siggo) GroupMembers(group *Contact) []*Contact {
+	members := make([]*Contact, 0, len(group.members))
+	for _, number := range group.members {
+		if number == s.config.UserNumber {
+			continue
+		}
+		c, ok := s.contact(number)
+		if !ok {
+			c = &Contact{Number: number}
+		}
+		members = append(members, c)
+	}
+	return members
+}
+
+// addMembers remembers that `numbers` are in `group`
+func (s *Siggo) addMembers(group *Contact, numbers ...PhoneNumber) {
+	for _, number := range numbers {
+		if number == "" || group.HasMember(number) {
+			continue
+		}
+		group.members = append(group.members, number)
+	}
+}
+
+// isQuiet returns whether a group is configured not to notify us unless we are mentioned
+func (s *Siggo) isQuiet(group *Contact) bool {
+	for _, quiet := range s.config.QuietGroups {
+		if quiet == group.Number || quiet == group.Name || quiet == group.String() {
+			return true
+		}
+	}
+	return false
+}
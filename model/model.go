@@ -8,7 +8,9 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/derricw/siggo/signal"
@@ -26,6 +28,9 @@ var ReadStatus map[bool]string = map[bool]string{
 	false: "X",
 }
 
+// SelfName is how we show ourselves in a conversation
+const SelfName = "~"
+
 // PhoneNumber is an alias for string not derived
 type PhoneNumber = string
 
@@ -33,9 +38,13 @@ type Contact struct {
 	Number  PhoneNumber
 	Name    string
 	Index   int
+	UUID    string `json:",omitempty"`
 	alias   string
 	color   string
 	isGroup bool
+	blocked bool
+	// members are the numbers of everyone in a group, as far as we know
+	members []PhoneNumber
 }
 
 // String returns a string to display for this contact. Priority is Alias > Name > Number.
@@ -71,6 +80,26 @@ func (c *Contact) Avatar() string {
 	return path
 }
 
+// IsGroup returns whether the contact is a group
+func (c *Contact) IsGroup() bool {
+	return c.isGroup
+}
+
+// IsBlocked returns true if we have blocked this contact or group
+func (c *Contact) IsBlocked() bool {
+	return c.blocked
+}
+
+// HasMember returns whether `number` is a member of the group
+func (c *Contact) HasMember(number PhoneNumber) bool {
+	for _, member := range c.members {
+		if member == number {
+			return true
+		}
+	}
+	return false
+}
+
 // Configure applies a configuration to the contact (for now, an alias and custom color)
 func (c *Contact) Configure(cfg *Config) {
 	c.color = cfg.ContactColors[c.Name]
@@ -136,6 +165,24 @@ func (cl ContactList) AllNames() []string {
 	return s
 }
 
+// Lookup finds a contact by number, group ID or name. Returns nil if there is no match.
+func (cl ContactList) Lookup(nameOrNumber string) *Contact {
+	if c, ok := cl[nameOrNumber]; ok {
+		return c
+	}
+	return cl.FindContact(nameOrNumber)
+}
+
+// FindByUUID returns the contact with the given UUID, or nil if there isn't one
+func (cl ContactList) FindByUUID(uuid string) *Contact {
+	for _, contact := range cl {
+		if contact.UUID != "" && contact.UUID == uuid {
+			return contact
+		}
+	}
+	return nil
+}
+
 // FindContact searches the contact list for the first contact whose name matches the
 // supplied pattern. Returns nil if no match is found.
 func (cl ContactList) FindContact(pattern string) *Contact {
@@ -155,11 +202,110 @@ type Message struct {
 	IsRead      bool          `json:"is_read"`
 	FromSelf    bool          `json:"from_self"`
 	Attachments []*Attachment `json:"attachments"`
-	From        string        `json:from"`
-	FromContact *Contact      `json:from_contact"`
+	From        string        `json:"From"`
+	FromContact *Contact      `json:"FromContact"`
+	// Reactions are keyed by the number of whoever reacted, since everyone gets one reaction
+	Reactions map[PhoneNumber]*Reaction `json:"reactions,omitempty"`
+	// Quote is the message this one is replying to, if any
+	Quote *Quote `json:"quote,omitempty"`
+	// Mentions are the group members mentioned in the content, as "@Name"
+	Mentions []*Mention `json:"mentions,omitempty"`
+	// Sticker is set if the message is a sticker. The sticker file is one of the attachments.
+	Sticker *Sticker `json:"sticker,omitempty"`
+	// ViewOnce media can only be opened once, after which we delete our copy
+	ViewOnce bool `json:"view_once,omitempty"`
+	// ReceiptSent is set once we've sent a read receipt for the message
+	ReceiptSent bool `json:"receipt_sent,omitempty"`
+	// IsDeleted is set when the message was deleted for everyone. Its content is gone.
+	IsDeleted bool `json:"is_deleted,omitempty"`
+	// ExpiresIn is the disappearing message timer in seconds, 0 if the message doesn't disappear
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+	// ExpiresAt is when the message disappears (ms since epoch). The timer starts once we've
+	// read the message, so this is 0 until then.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+	// Kind is SystemMessage for entries that siggo adds itself, like calls. It is empty for
+	// messages.
+	Kind MessageKind `json:"kind,omitempty"`
+	// SendState is set while a message of ours is in the outbox, and SendError says why the last
+	// attempt to send it failed
+	SendState OutboxState `json:"send_state,omitempty"`
+	SendError string      `json:"send_error,omitempty"`
+	// Edits are the earlier versions of an edited message, oldest first, and EditedAt is when
+	// the current version was sent
+	Edits    []*Edit `json:"edits,omitempty"`
+	EditedAt int64   `json:"edited_at,omitempty"`
+}
+
+// MessageKind tells messages apart from other conversation entries
+type MessageKind string
+
+// SystemMessage is an entry that records something that happened, like a call, rather than
+// something somebody wrote
+const SystemMessage MessageKind = "system"
+
+// DeletedContent replaces the content of messages that were deleted for everyone
+const DeletedContent = "🗑 this message was deleted"
+
+// ViewOnceContent is shown for view-once media without a caption
+const ViewOnceContent = "👁 view-once media"
+
+// Sticker is a sticker from a sticker pack
+type Sticker struct {
+	PackID    string `json:"pack_id"`
+	StickerID int    `json:"sticker_id"`
+	Emoji     string `json:"emoji"`
+}
+
+// String renders the sticker like "[sticker 😀]"
+func (s *Sticker) String() string {
+	if s.Emoji == "" {
+		// "[sticker]" on its own would be taken for a color tag, so escape it
+		return "[sticker[]"
+	}
+	return fmt.Sprintf("[sticker %s]", s.Emoji)
+}
+
+// setSticker makes the message a sticker message. The sticker file is added to the attachments
+// so that it can be opened.
+func (m *Message) setSticker(wire *signal.Sticker, uname string) {
+	m.Sticker = &Sticker{
+		PackID:    wire.PackID,
+		StickerID: wire.StickerID,
+		Emoji:     wire.Emoji,
+	}
+	var a *Attachment
+	if wire.Attachment != nil {
+		a = NewAttachmentFromWire(wire.Attachment, m.Timestamp, m.FromSelf)
+	} else {
+		folder, err := signal.GetSignalStickerFolder(uname)
+		if err != nil {
+			log.Warnf("couldn't find sticker folder: %v", err)
+			return
+		}
+		// attachments without an ID are opened by filename
+		a = &Attachment{
+			ContentType: "image/webp",
+			Filename:    filepath.Join(folder, wire.PackID, strconv.Itoa(wire.StickerID)),
+			Timestamp:   m.Timestamp,
+			FromSelf:    m.FromSelf,
+		}
+	}
+	a.IsSticker = true
+	m.Attachments = append(m.Attachments, a)
+}
+
+// setViewOnce marks the message and its attachments as view-once
+func (m *Message) setViewOnce() {
+	m.ViewOnce = true
+	for _, a := range m.Attachments {
+		a.ViewOnce = true
+	}
 }
 
 func (m *Message) String() string {
+	if m.Kind == SystemMessage {
+		return m.systemString()
+	}
 	var fromStr, color string
 	if !m.FromSelf {
 		fromStr = m.FromContact.String()
@@ -169,6 +315,18 @@ func (m *Message) String() string {
 	}
 
 	template := "%s|%s%s| %" + fmt.Sprintf("%dv", len(fromStr)) + ": %s\n"
+	content := m.highlightMentions()
+	if m.Sticker != nil {
+		content = m.Sticker.String()
+	} else if m.ViewOnce && content == "" {
+		content = ViewOnceContent
+	}
+	if len(m.Edits) > 0 {
+		content = fmt.Sprintf("%s (edited)", content)
+	}
+	if status := m.sendStatus(); status != "" {
+		content = fmt.Sprintf("%s %s", content, status)
+	}
 	data := fmt.Sprintf(template,
 		// lets come up with a way to avoid the *1000000
 		// Magical Ref Data: Mon Jan 2 15:04:05 MST 2006
@@ -176,7 +334,7 @@ func (m *Message) String() string {
 		DeliveryStatus[m.IsDelivered],
 		ReadStatus[m.IsRead],
 		fromStr,
-		m.Content,
+		content,
 	)
 	if m.FromSelf == true {
 		// dim messages from self (for now, until we support color for contacts)
@@ -187,13 +345,162 @@ func (m *Message) String() string {
 	} else if m.IsRead == true {
 		data = fmt.Sprintf("[%s::]%s[-::]", color, data)
 	}
+	// show what we are replying to above the message
+	if m.Quote != nil {
+		data = fmt.Sprintf("[::d]%s[::-]\n%s", m.Quote, data)
+	}
 	// show attachments
 	for _, a := range m.Attachments {
+		if a.IsSticker {
+			// the sticker is already shown as the content
+			continue
+		}
 		data = fmt.Sprintf("%s%s\n", data, a)
 	}
+	if len(m.Reactions) > 0 {
+		data = fmt.Sprintf("%s%s\n", data, m.reactionString())
+	}
 	return data
 }
 
+// systemString renders an entry that isn't a message, bold until we've seen it
+func (m *Message) systemString() string {
+	data := fmt.Sprintf("%s| %s",
+		time.Unix(0, m.Timestamp*1000000).Format("2006-01-02 15:04:05"),
+		m.Content,
+	)
+	if !m.IsRead {
+		return fmt.Sprintf("[::b]%s[::-]\n", data)
+	}
+	return fmt.Sprintf("[::d]%s[::-]\n", data)
+}
+
+// highlightMentions returns the content with mentions underlined. tview style tags replace the
+// attributes instead of adding to them, so we put back whatever String() uses for the message.
+func (m *Message) highlightMentions() string {
+	if len(m.Mentions) == 0 {
+		return m.Content
+	}
+	attrs := "-"
+	if m.FromSelf {
+		attrs = "d"
+	} else if !m.IsRead {
+		attrs = "b"
+	}
+	out := strings.Builder{}
+	pos := 0
+	for _, mention := range m.Mentions {
+		start, end := mention.Start, mention.Start+mention.Length
+		if mention.Length == 0 {
+			// saved before we kept where mentions are, so find the next one
+			i := strings.Index(m.Content[pos:], "@"+mention.Name)
+			if i < 0 {
+				continue
+			}
+			start, end = pos+i, pos+i+len("@"+mention.Name)
+		}
+		if start < pos || end > len(m.Content) {
+			continue
+		}
+		out.WriteString(m.Content[pos:start])
+		out.WriteString(fmt.Sprintf("[::%su]%s[::%s]", strings.Trim(attrs, "-"), m.Content[start:end], attrs))
+		pos = end
+	}
+	out.WriteString(m.Content[pos:])
+	return out.String()
+}
+
+// Delete replaces the message with a tombstone, after it was deleted for everyone
+func (m *Message) Delete() {
+	m.Content = DeletedContent
+	m.Attachments = make([]*Attachment, 0)
+	m.Reactions = nil
+	m.Quote = nil
+	m.Mentions = nil
+	m.Sticker = nil
+	m.Edits = nil
+	m.IsDeleted = true
+}
+
+// startExpiry starts the disappearing message timer, if the message has one and it hasn't
+// started yet
+func (m *Message) startExpiry(now time.Time) {
+	if m.ExpiresIn <= 0 || m.ExpiresAt != 0 {
+		return
+	}
+	m.ExpiresAt = now.Add(time.Duration(m.ExpiresIn)*time.Second).UnixNano() / 1000000
+}
+
+// isUnread returns whether the message is from someone else and we haven't read it yet
+func (m *Message) isUnread() bool {
+	return !m.IsRead && !m.FromSelf
+}
+
+// isExpired returns whether the message should have disappeared by `now`
+func (m *Message) isExpired(now time.Time) bool {
+	return m.ExpiresAt != 0 && m.ExpiresAt <= now.UnixNano()/1000000
+}
+
+// reactionString renders all reactions to the message on a single line
+func (m *Message) reactionString() string {
+	numbers := make([]string, 0, len(m.Reactions))
+	for number := range m.Reactions {
+		numbers = append(numbers, number)
+	}
+	sort.Strings(numbers)
+	reactions := make([]string, 0, len(numbers))
+	for _, number := range numbers {
+		reactions = append(reactions, m.Reactions[number].String())
+	}
+	return fmt.Sprintf("   ╰ %s", strings.Join(reactions, "  "))
+}
+
+// AddReaction sets the reaction from `number`, replacing any reaction they already had
+func (m *Message) AddReaction(number PhoneNumber, reaction *Reaction) {
+	if m.Reactions == nil {
+		m.Reactions = make(map[PhoneNumber]*Reaction)
+	}
+	m.Reactions[number] = reaction
+}
+
+// RemoveReaction removes the reaction from `number`, if they had one
+func (m *Message) RemoveReaction(number PhoneNumber) {
+	delete(m.Reactions, number)
+}
+
+// Reaction is an emoji reaction to a message
+type Reaction struct {
+	Emoji     string `json:"emoji"`
+	From      string `json:"from"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// String returns the emoji and who it is from
+func (r *Reaction) String() string {
+	return fmt.Sprintf("%s %s", r.Emoji, r.From)
+}
+
+// Quote is the part of a message that a reply quotes
+type Quote struct {
+	// ID is the timestamp of the quoted message
+	ID     int64  `json:"id"`
+	Author string `json:"author"`
+	From   string `json:"from"`
+	Text   string `json:"text"`
+}
+
+// String renders the quote as a single line to go above the reply
+func (q *Quote) String() string {
+	text := strings.Join(strings.Fields(q.Text), " ")
+	if r := []rune(text); len(r) > maxQuoteLength {
+		text = string(r[:maxQuoteLength]) + "…"
+	}
+	return fmt.Sprintf("   ┌ %s: %s", q.From, text)
+}
+
+// maxQuoteLength is how much of a quoted message we show above a reply, in runes
+const maxQuoteLength = 60
+
 // AddAttachments currently only is used to track attachments we sent to other people, so that
 // they show up in the GUI.
 func (m *Message) AddAttachments(paths []string) {
@@ -215,9 +522,8 @@ func (m *Message) AddAttachments(paths []string) {
 	}
 }
 
-// Attachment is any file sent or received. Received attachments are left in the usual `signal-cli`
-// location for now. It seems to automatically delete old attachments, so we may want to come up
-// with a way to keep our own copy somewhere in the siggo data folder.
+// Attachment is any file sent or received. signal-cli deletes old attachments after a while, so
+// we keep our own copy in AttachmentFolder (see store).
 type Attachment struct {
 	ContentType string `json:"contentType"`
 	Filename    string `json:"filename"`
@@ -225,13 +531,33 @@ type Attachment struct {
 	Size        int    `json:"size"`
 	Timestamp   int64  `json:"timestamp"`
 	FromSelf    bool   `json:"from_self"`
+	IsSticker   bool   `json:"is_sticker,omitempty"`
+	// ViewOnce attachments can only be opened once. Viewed is set once they have been.
+	ViewOnce bool `json:"view_once,omitempty"`
+	Viewed   bool `json:"viewed,omitempty"`
+	// Hash is the sha256 of the file, which names our copy of it. It is empty if we don't have a
+	// copy.
+	Hash string `json:"hash,omitempty"`
+	// OriginalName is the name the file had when it was sent, without its folder
+	OriginalName string `json:"original_name,omitempty"`
+}
+
+// Path returns the full path to an attachment file. That is our own copy if we have one,
+// otherwise wherever signal-cli (or we, when sending) left it.
+func (a *Attachment) Path() (string, error) {
+	if a.Hash != "" {
+		path := filepath.Join(AttachmentFolder(), a.storeName())
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return a.sourcePath()
 }
 
-// Path returns the full path to an attachment file
-func (a *Attachment) Path() (string, error) {
+// sourcePath returns the path signal-cli gave us for the file, or the path we attached it from
+func (a *Attachment) sourcePath() (string, error) {
 	if a.ID == "" {
-		// TODO: save our own copy of the attachment with our own ID
-		// for now, just return the path where we attached it
+		// attachments we sent (and stickers from packs) are where we found them
 		return a.Filename, nil
 	}
 	folder, err := signal.GetSignalFolder()
@@ -245,6 +571,11 @@ func (a *Attachment) Path() (string, error) {
 func (a *Attachment) String() string {
 	ts := time.Unix(0, a.Timestamp*1000000).Format("2006-01-02 15:04:05")
 	txt := fmt.Sprintf(" 📎| %s | %s | %s | %dB", ts, a.Filename, a.ContentType, a.Size)
+	if a.Viewed {
+		txt += " | viewed"
+	} else if a.ViewOnce {
+		txt += " | view once"
+	}
 	return txt
 }
 
@@ -280,10 +611,31 @@ type Conversation struct {
 	// since the last save to disk
 	hasNewData        bool
 	stagedAttachments []string
+	stagedQuote       *Message
+	stagedEdit        *Message
+	// typing tracks who is typing and when they last told us so. It is touched from the receive
+	// loop, the UI and the sweeper, so it has its own lock.
+	typing     map[*Contact]time.Time
+	typingLock sync.Mutex
+	// typingSent is when we last told the contact that we are typing, zero if we haven't. The UI
+	// and Send both change it, so it is guarded by typingLock too.
+	typingSent time.Time
+	// ExpiresIn is the current disappearing message timer in seconds, 0 if it is off
+	ExpiresIn int64
+	// messageLock guards Messages and MessageOrder, since the sweeper removes expired messages
+	// from its own goroutine
+	messageLock sync.Mutex
+	// unread counts the messages from others that we haven't read, so that UnreadCount doesn't
+	// have to look at every message. It is guarded by messageLock.
+	unread int
+	// folder is where the conversation is saved, see AccountConversationFolder
+	folder string
 }
 
 // String renders the conversation to a single string
 func (c *Conversation) String() string {
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
 	out := ""
 	for _, k := range c.MessageOrder {
 		out += c.Messages[k].String()
@@ -297,6 +649,8 @@ func (c *Conversation) Filter(pattern string) string {
 	if pattern == "" {
 		return c.String()
 	}
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
 	out := ""
 	for _, k := range c.MessageOrder {
 		s := c.Messages[k].String()
@@ -307,14 +661,23 @@ func (c *Conversation) Filter(pattern string) string {
 	return out
 }
 
-// AddMessage appends a message to the conversation
+// AddMessage appends a message to the conversation, copying its attachments to our store
 func (c *Conversation) AddMessage(message *Message) {
+	message.storeAttachments()
 	c.addMessage(message)
 }
 
 func (c *Conversation) addMessage(message *Message) {
-	_, ok := c.Messages[message.Timestamp]
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
+	old, ok := c.Messages[message.Timestamp]
 	c.Messages[message.Timestamp] = message
+	if ok && old.isUnread() {
+		c.unread--
+	}
+	if message.isUnread() {
+		c.unread++
+	}
 	if !ok {
 		// new messages
 		// TODO: this section is to prevent saved pre-groups conversations from breaking when
@@ -331,6 +694,8 @@ func (c *Conversation) addMessage(message *Message) {
 
 // LastMessage returns the most recent message. Can be nil.
 func (c *Conversation) LastMessage() *Message {
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
 	nMessage := len(c.MessageOrder)
 	if nMessage > 0 {
 		lastMsgID := c.MessageOrder[nMessage-1]
@@ -339,6 +704,25 @@ func (c *Conversation) LastMessage() *Message {
 	return nil
 }
 
+// MessageList returns the messages in order
+func (c *Conversation) MessageList() []*Message {
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
+	messages := make([]*Message, 0, len(c.MessageOrder))
+	for _, ID := range c.MessageOrder {
+		messages = append(messages, c.Messages[ID])
+	}
+	return messages
+}
+
+// message returns the message with `timestamp`
+func (c *Conversation) message(timestamp int64) (*Message, bool) {
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
+	msg, ok := c.Messages[timestamp]
+	return msg, ok
+}
+
 // StageAttachment attaches a file to be sent in the next message
 func (c *Conversation) AddAttachment(path string) error {
 	if _, err := os.Stat(path); err != nil {
@@ -354,6 +738,36 @@ func (c *Conversation) ClearAttachments() {
 	c.stagedAttachments = []string{}
 }
 
+// StageQuote sets a message that the next message we send will reply to
+func (c *Conversation) StageQuote(message *Message) {
+	c.stagedQuote = message
+}
+
+// StagedQuote returns the message we are replying to, or nil if we aren't
+func (c *Conversation) StagedQuote() *Message {
+	return c.stagedQuote
+}
+
+// ClearQuote removes any staged quote
+func (c *Conversation) ClearQuote() {
+	c.stagedQuote = nil
+}
+
+// StageEdit sets a message of ours that the next message we send will replace
+func (c *Conversation) StageEdit(message *Message) {
+	c.stagedEdit = message
+}
+
+// StagedEdit returns the message we are editing, or nil if we aren't
+func (c *Conversation) StagedEdit() *Message {
+	return c.stagedEdit
+}
+
+// ClearEdit stops editing
+func (c *Conversation) ClearEdit() {
+	c.stagedEdit = nil
+}
+
 // ClearStagedMessage removes any staged attachments
 func (c *Conversation) ClearStagedMessage() {
 	c.StagedMessage = ""
@@ -363,6 +777,8 @@ func (c *Conversation) ClearStagedMessage() {
 func (c *Conversation) ClearStaged() {
 	c.ClearStagedMessage()
 	c.ClearAttachments()
+	c.ClearQuote()
+	c.ClearEdit()
 }
 
 // NumAttachments returns the number of staged attachments
@@ -380,17 +796,189 @@ func (c *Conversation) HasStagedData() bool {
 	return c.HasStagedMessage() || c.NumAttachments() != 0
 }
 
+// SetTyping records whether `contact` is typing in this conversation
+func (c *Conversation) SetTyping(contact *Contact, typing bool) {
+	c.typingLock.Lock()
+	defer c.typingLock.Unlock()
+	if c.typing == nil {
+		c.typing = make(map[*Contact]time.Time)
+	}
+	if typing {
+		c.typing[contact] = time.Now()
+	} else {
+		delete(c.typing, contact)
+	}
+}
+
+// Typing returns everyone who is currently typing in this conversation, sorted by name
+func (c *Conversation) Typing() []*Contact {
+	c.typingLock.Lock()
+	defer c.typingLock.Unlock()
+	typing := make([]*Contact, 0, len(c.typing))
+	for contact := range c.typing {
+		typing = append(typing, contact)
+	}
+	sort.Slice(typing, func(i, j int) bool {
+		return typing[i].String() < typing[j].String()
+	})
+	return typing
+}
+
+// TypingString describes who is typing, like "Alice is typing…". Empty if nobody is.
+func (c *Conversation) TypingString() string {
+	typing := c.Typing()
+	switch len(typing) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf("%s is typing…", typing[0])
+	case 2:
+		return fmt.Sprintf("%s and %s are typing…", typing[0], typing[1])
+	default:
+		return "several people are typing…"
+	}
+}
+
+// expireTyping forgets anyone who hasn't told us they are typing since `TypingTimeout` before
+// `now`. Returns whether anything changed.
+func (c *Conversation) expireTyping(now time.Time) bool {
+	c.typingLock.Lock()
+	defer c.typingLock.Unlock()
+	expired := false
+	for contact, since := range c.typing {
+		if now.Sub(since) > TypingTimeout {
+			delete(c.typing, contact)
+			expired = true
+		}
+	}
+	return expired
+}
+
+// expireMessages removes any messages whose disappearing message timer has run out by `now`.
+// Returns whether anything was removed.
+func (c *Conversation) expireMessages(now time.Time) bool {
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
+	order := make([]int64, 0, len(c.MessageOrder))
+	for _, ID := range c.MessageOrder {
+		if msg := c.Messages[ID]; msg.isExpired(now) {
+			if msg.isUnread() {
+				c.unread--
+			}
+			delete(c.Messages, ID)
+			continue
+		}
+		order = append(order, ID)
+	}
+	if len(order) == len(c.MessageOrder) {
+		return false
+	}
+	c.MessageOrder = order
+	c.hasNewData = true
+	return true
+}
+
+// moveMessage gives a message a new timestamp, keeping its place in the conversation
+func (c *Conversation) moveMessage(from, to int64) {
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
+	msg, ok := c.Messages[from]
+	if !ok || from == to {
+		return
+	}
+	delete(c.Messages, from)
+	msg.Timestamp = to
+	c.Messages[to] = msg
+	for i, ID := range c.MessageOrder {
+		if ID == from {
+			c.MessageOrder[i] = to
+		}
+	}
+	c.hasNewData = true
+}
+
+// removeMessage removes a message from the conversation
+func (c *Conversation) removeMessage(timestamp int64) {
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
+	msg, ok := c.Messages[timestamp]
+	if !ok {
+		return
+	}
+	if msg.isUnread() {
+		c.unread--
+	}
+	delete(c.Messages, timestamp)
+	order := make([]int64, 0, len(c.MessageOrder))
+	for _, ID := range c.MessageOrder {
+		if ID != timestamp {
+			order = append(order, ID)
+		}
+	}
+	c.MessageOrder = order
+	c.hasNewData = true
+}
+
+// markRead marks the message from `sender` at `timestamp` as read, if we have it. Returns
+// whether we did.
+func (c *Conversation) markRead(sender PhoneNumber, timestamp int64, now time.Time) bool {
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
+	msg, ok := c.Messages[timestamp]
+	if !ok || msg.FromSelf || msg.FromContact == nil || msg.FromContact.Number != sender {
+		return false
+	}
+	if msg.isUnread() {
+		c.unread--
+	}
+	msg.IsRead = true
+	msg.startExpiry(now)
+	c.hasNewData = true
+	// we're caught up if there is nothing unread left
+	c.HasNewMessage = c.unread > 0
+	return true
+}
+
+// TimerString describes the disappearing message timer, like "1h". Empty if it is off.
+func (c *Conversation) TimerString() string {
+	if c.ExpiresIn <= 0 {
+		return ""
+	}
+	return FormatTimer(c.ExpiresIn)
+}
+
 // CaughtUp iterates back through the messages of the conversation marking the un-read ones
-// as read. We call this after we switch to this conversation.
-func (c *Conversation) CaughtUp() {
+// as read. We call this after we switch to this conversation. Returns the messages from other
+// people that we just read.
+func (c *Conversation) CaughtUp() []*Message {
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
+	read := make([]*Message, 0)
+	now := time.Now()
 	for i := len(c.MessageOrder) - 1; i >= 0; i-- {
 		msg := c.Messages[c.MessageOrder[i]]
 		if msg.IsRead && !msg.FromSelf {
 			break
 		}
-		c.Messages[c.MessageOrder[i]].IsRead = true
+		if msg.isUnread() {
+			c.unread--
+			if msg.Kind != SystemMessage {
+				read = append(read, msg)
+			}
+		}
+		msg.IsRead = true
+		// disappearing messages start disappearing once they are read
+		msg.startExpiry(now)
 	}
 	c.HasNewMessage = false
+	return read
+}
+
+// UnreadCount returns how many messages from others we haven't read yet
+func (c *Conversation) UnreadCount() int {
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
+	return c.unread
 }
 
 // SaveAs writes the conversation to `path`.
@@ -400,6 +988,8 @@ func (c *Conversation) SaveAs(path string) error {
 		return err
 	}
 	defer f.Close()
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
 	for _, msgID := range c.MessageOrder {
 		msg := c.Messages[msgID]
 		b, err := json.Marshal(msg)
@@ -417,12 +1007,15 @@ func (c *Conversation) Save() error {
 	if !c.hasNewData {
 		return nil
 	}
-	folder := ConversationFolder()
+	folder := c.folder
+	if folder == "" {
+		folder = ConversationFolder()
+	}
 	err := os.MkdirAll(folder, os.ModePerm)
 	if err != nil {
 		return err
 	}
-	path := filepath.Join(ConversationFolder(), c.Contact.Number)
+	path := filepath.Join(folder, c.Contact.Number)
 	c.hasNewData = false // better to do this after successful save?
 	return c.SaveAs(path)
 }
@@ -446,6 +1039,10 @@ func (c *Conversation) Load(path string, cfg *Config) error {
 		if msg.FromContact != nil {
 			msg.FromContact.Configure(cfg)
 		}
+		if msg.isExpired(time.Now()) {
+			continue
+		}
+		c.ExpiresIn = msg.ExpiresIn
 		c.addMessage(msg)
 	}
 	return nil
@@ -462,35 +1059,81 @@ func NewConversation(contact *Contact) *Conversation {
 	}
 }
 
+// TypingTimeout is how long we believe that someone is typing after they tell us. Signal clients
+// repeat the typing indicator every few seconds while typing continues.
+const TypingTimeout = 15 * time.Second
+
+// typingResend is how often we repeat our own typing indicator while we keep typing
+const typingResend = 10 * time.Second
+
 type SignalAPI interface {
 	Send(string, string) (int64, error)
+	SendMessage(string, bool, string, *signal.SendOptions) (int64, error)
 	SendDbus(string, string, ...string) (int64, error)
 	SendGroupDbus(string, string, ...string) (int64, error)
 	Receive() error
+	SendReaction(string, bool, string, string, int64, bool) error
+	SendTyping(string, bool, bool) error
+	SendRemoteDelete(string, bool, int64) error
+	SendReadReceipt(string, []int64) error
+	UpdateGroup(string, *signal.GroupUpdate) (string, error)
+	QuitGroup(string) error
+	UpdateProfile(*signal.ProfileUpdate) error
+	UpdateContact(string, string) error
+	RemoveContact(string) error
+	Block(string, bool) error
+	Unblock(string, bool) error
+	ListIdentities(string) ([]*signal.Identity, error)
+	Trust(string, string) error
+	SetExpiration(string, bool, int64) error
 	RequestGroupInfo() ([]signal.SignalGroupInfo, error)
+	GetContactList() ([]*signal.SignalContact, error)
+	GetGroupList() ([]*signal.SignalGroup, error)
 	ReceiveForever()
 	Close()
 	OnReceived(signal.ReceivedCallback)
 	OnReceipt(signal.ReceiptCallback)
 	OnSent(signal.SentCallback)
 	OnError(signal.ErrorCallback)
+	OnTyping(signal.TypingCallback)
+	OnReadSync(signal.ReadSyncCallback)
+	OnCall(signal.CallCallback)
+	OnEdit(signal.EditCallback)
+	OnStateChange(signal.StateChangeCallback)
 }
 
 type Siggo struct {
-	config        *Config
+	config *Config
+	// contacts is read by the receive loop and the UI, and changed by both, so it is guarded by
+	// contactsLock. Use contact, contactFor and groupFor instead of the map.
 	contacts      ContactList
+	contactsLock  sync.RWMutex
 	conversations map[*Contact]*Conversation
 	contactOrder  []*Contact
 	signal        SignalAPI
 	initialized   chan bool
 
+	// conversationsLock guards adding conversations against the sweeper
+	conversationsLock sync.RWMutex
+	// calls are the calls we've been offered and haven't seen the end of, by call ID
+	calls map[int64]*call
+	// outbox holds the messages we are sending until they have been sent
+	outbox     []*OutgoingMessage
+	outboxLock sync.Mutex
+	// viewed are view-once files that have been opened but not deleted yet, see ViewAttachment
+	viewed     map[string]bool
+	viewedLock sync.Mutex
+
 	NewInfo    func(*Conversation)
 	ErrorEvent func(error)
+	// StateChange is called whenever our connection to signal-cli changes state
+	StateChange func(signal.ConnState)
 }
 
-// Send sends a message to a contact.
+// Send sends a message to a contact. The message goes through the outbox, so if it can't be sent
+// right away it stays in the conversation until it is sent or we give up on it.
 func (s *Siggo) Send(msg string, contact *Contact) error {
-	ts := time.Now().Unix() * 1000
+	ts := time.Now().UnixNano() / 1000000
 	message := &Message{
 		Content:     msg,
 		From:        " ~ ",
@@ -500,49 +1143,478 @@ func (s *Siggo) Send(msg string, contact *Contact) error {
 		FromSelf:    true,
 		Attachments: make([]*Attachment, 0),
 	}
-	conv, ok := s.conversations[contact]
+	conv := s.conversationFor(contact)
+	opts := &signal.SendOptions{}
+	if contact.isGroup {
+		opts.Mentions, message.Mentions = s.findMentions(msg, contact)
+	}
+	if quoted := conv.StagedQuote(); quoted != nil {
+		opts.QuoteTimestamp = quoted.Timestamp
+		opts.QuoteAuthor = s.authorOf(quoted)
+		message.Quote = &Quote{
+			ID:     quoted.Timestamp,
+			Author: opts.QuoteAuthor,
+			From:   s.quoteFrom(opts.QuoteAuthor),
+			Text:   quoted.Content,
+		}
+	}
+	// sending a message stops the typing indicator on the other end
+	conv.typingLock.Lock()
+	conv.typingSent = time.Time{}
+	conv.typingLock.Unlock()
+	s.CaughtUp(contact)
+	message.AddAttachments(conv.stagedAttachments)
+	conv.ClearStaged()
+	conv.AddMessage(message)
+	// send our copies of the attachments, in case the originals are gone by the time we retry
+	for _, a := range message.Attachments {
+		path, err := a.Path()
+		if err != nil {
+			path = a.Filename
+		}
+		opts.Attachments = append(opts.Attachments, path)
+	}
+	// the outbox takes it from here
+	o := &OutgoingMessage{
+		ID:      ts,
+		To:      contact.Number,
+		IsGroup: contact.isGroup,
+		Message: message,
+		Options: opts,
+		conv:    conv,
+	}
+	s.queue(o)
+	return s.sendOutgoing(o)
+}
+
+// React sends an emoji reaction to a message in the conversation with `contact`. An empty emoji
+// removes our existing reaction instead.
+func (s *Siggo) React(contact *Contact, message *Message, emoji string) error {
+	author := s.authorOf(message)
+	conv := s.conversationFor(contact)
+	remove := emoji == ""
+	if remove {
+		conv.messageLock.Lock()
+		reaction, ok := message.Reactions[s.config.UserNumber]
+		conv.messageLock.Unlock()
+		if !ok {
+			return nil
+		}
+		// signal needs to know which emoji we are removing
+		emoji = reaction.Emoji
+	}
+	err := s.signal.SendReaction(contact.Number, contact.isGroup, emoji, author, message.Timestamp, remove)
+	if err != nil {
+		return err
+	}
+	conv.messageLock.Lock()
+	if remove {
+		message.RemoveReaction(s.config.UserNumber)
+	} else {
+		message.AddReaction(s.config.UserNumber, &Reaction{
+			Emoji:     emoji,
+			From:      SelfName,
+			Timestamp: time.Now().Unix() * 1000,
+		})
+	}
+	conv.hasNewData = true
+	conv.messageLock.Unlock()
+	s.NewInfo(conv)
+	return nil
+}
+
+// authorOf returns the number of whoever wrote a message
+func (s *Siggo) authorOf(message *Message) PhoneNumber {
+	if !message.FromSelf && message.FromContact != nil {
+		return message.FromContact.Number
+	}
+	return s.config.UserNumber
+}
+
+// quoteFrom returns the name we show for the author of a quoted message
+func (s *Siggo) quoteFrom(author string) string {
+	if author == s.config.UserNumber {
+		return SelfName
+	}
+	if c, ok := s.contact(author); ok {
+		return c.String()
+	}
+	return author
+}
+
+// convertQuote converts a quote from the wire
+func (s *Siggo) convertQuote(quote *signal.Quote) *Quote {
+	if quote == nil {
+		return nil
+	}
+	author := quote.AuthorNumber
+	if author == "" {
+		author = quote.Author
+	}
+	return &Quote{
+		ID:     quote.ID,
+		Author: author,
+		From:   s.quoteFrom(author),
+		Text:   quote.Text,
+	}
+}
+
+// DeleteForEveryone deletes one of our own messages in the conversation with `contact` for
+// everyone in it
+func (s *Siggo) DeleteForEveryone(contact *Contact, message *Message) error {
+	if !message.FromSelf {
+		return fmt.Errorf("can only delete our own messages for everyone")
+	}
+	if message.IsDeleted {
+		return nil
+	}
+	err := s.signal.SendRemoteDelete(contact.Number, contact.isGroup, message.Timestamp)
+	if err != nil {
+		return err
+	}
+	s.deleteMessage(s.conversationFor(contact), message.Timestamp)
+	return nil
+}
+
+// deleteMessage replaces a message in `conv` with a tombstone and saves the conversation.
+// Returns the deleted message, or nil if we don't have it.
+func (s *Siggo) deleteMessage(conv *Conversation, timestamp int64) *Message {
+	conv.messageLock.Lock()
+	message, ok := conv.Messages[timestamp]
 	if !ok {
-		log.Infof("new conversation for contact: %v", contact)
-		conv = s.newConversation(contact)
-	}
-	// finally send the message
-	var ID int64
-	var err error
-	if !contact.isGroup {
-		log.Debugf("sending message to contact: %v", contact)
-		ID, err = s.signal.SendDbus(contact.Number, msg, conv.stagedAttachments...)
+		conv.messageLock.Unlock()
+		log.Warnf("remote delete of message we don't have: %d", timestamp)
+		return nil
+	}
+	message.Delete()
+	conv.hasNewData = true
+	conv.messageLock.Unlock()
+	// the deleted content shouldn't hang around on disk either
+	if s.config.SaveMessages {
+		if err := conv.Save(); err != nil {
+			log.Errorf("failed to save conversation: %v", err)
+		}
+	}
+	s.NewInfo(conv)
+	return message
+}
+
+// addMedia adds a sticker and the view-once flag from the wire to a message
+func (s *Siggo) addMedia(message *Message, sticker *signal.Sticker, viewOnce bool) {
+	if sticker != nil {
+		message.setSticker(sticker, s.config.UserNumber)
+	}
+	if viewOnce {
+		message.setViewOnce()
+	}
+}
+
+// ViewAttachment returns the path to open an attachment in the conversation with `contact`.
+// View-once attachments are marked viewed right away, and `done` deletes our copy of the file. It
+// should be called once whatever opened the file is done with it.
+func (s *Siggo) ViewAttachment(contact *Contact, a *Attachment) (string, func(), error) {
+	path, err := a.Path()
+	if err != nil {
+		return "", nil, err
+	}
+	if !a.ViewOnce {
+		return path, func() {}, nil
+	}
+	conv := s.conversationFor(contact)
+	conv.messageLock.Lock()
+	if a.Viewed {
+		conv.messageLock.Unlock()
+		return "", nil, fmt.Errorf("view-once media has already been viewed")
+	}
+	a.Viewed = true
+	conv.hasNewData = true
+	conv.messageLock.Unlock()
+	if s.config.SaveMessages {
+		if err := conv.Save(); err != nil {
+			log.Errorf("failed to save conversation: %v", err)
+		}
+	}
+	s.NewInfo(conv)
+	// if we quit before `done`, Quit deletes it
+	s.viewedLock.Lock()
+	s.viewed[path] = true
+	s.viewedLock.Unlock()
+	done := func() { s.deleteViewed(path) }
+	return path, done, nil
+}
+
+// deleteViewed deletes a view-once file that has been opened, unless it is gone already
+func (s *Siggo) deleteViewed(path string) {
+	s.viewedLock.Lock()
+	pending := s.viewed[path]
+	delete(s.viewed, path)
+	s.viewedLock.Unlock()
+	if !pending {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Errorf("failed to delete view-once media: %v", err)
+	}
+}
+
+// deleteAllViewed deletes every view-once file that has been opened and not deleted yet
+func (s *Siggo) deleteAllViewed() {
+	s.viewedLock.Lock()
+	paths := make([]string, 0, len(s.viewed))
+	for path := range s.viewed {
+		paths = append(paths, path)
+	}
+	s.viewedLock.Unlock()
+	for _, path := range paths {
+		s.deleteViewed(path)
+	}
+}
+
+// removeViewedMedia deletes view-once files that saved conversations say have been viewed, in
+// case we didn't get to it before we quit last time
+func (s *Siggo) removeViewedMedia() {
+	for _, conv := range s.conversationList() {
+		for _, msg := range conv.MessageList() {
+			for _, a := range msg.Attachments {
+				if !a.ViewOnce || !a.Viewed {
+					continue
+				}
+				path, err := a.sourcePath()
+				if err != nil {
+					continue
+				}
+				if err := os.Remove(path); err == nil {
+					log.Infof("deleted viewed view-once media: %s", path)
+				} else if !os.IsNotExist(err) {
+					log.Errorf("failed to delete view-once media: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// onRemoteDelete handles someone deleting one of their messages for everyone
+func (s *Siggo) onRemoteDelete(msg *signal.Message) error {
+	dataMsg := msg.Envelope.DataMessage
+	c := s.contactFor(msg.Envelope.Source)
+	conv := s.conversationFor(c)
+	if dataMsg.GroupInfo != nil {
+		conv = s.conversationFor(s.groupFor(dataMsg.GroupInfo))
+	}
+	// people can only delete their own messages
+	message, ok := conv.message(dataMsg.RemoteDelete.Timestamp)
+	if ok && (message.FromSelf || message.FromContact == nil || message.FromContact.Number != c.Number) {
+		log.Warnf("%v tried to delete a message they didn't send: %d", c, message.Timestamp)
+		return nil
+	}
+	s.deleteMessage(conv, dataMsg.RemoteDelete.Timestamp)
+	return nil
+}
+
+// onRemoteDeleteSent handles us deleting a message for everyone from another device
+func (s *Siggo) onRemoteDeleteSent(msg *signal.Message) error {
+	sentMsg := msg.Envelope.SyncMessage.SentMessage
+	var conv *Conversation
+	if sentMsg.GroupInfo != nil {
+		conv = s.conversationFor(s.groupFor(sentMsg.GroupInfo))
 	} else {
-		log.Debugf("sending message to group: %v", contact)
-		ID, err = s.signal.SendGroupDbus(contact.Number, msg, conv.stagedAttachments...)
+		conv = s.conversationFor(s.contactFor(sentMsg.Destination))
 	}
+	s.deleteMessage(conv, sentMsg.RemoteDelete.Timestamp)
+	return nil
+}
+
+// SetExpiration sets the disappearing message timer for the conversation with `contact`, in
+// seconds. 0 turns it off.
+func (s *Siggo) SetExpiration(contact *Contact, seconds int64) error {
+	err := s.signal.SetExpiration(contact.Number, contact.isGroup, seconds)
 	if err != nil {
-		message.Content = fmt.Sprintf("FAILED TO SEND: %s ERROR: %v", message.Content, err)
-		s.NewInfo(conv)
 		return err
 	}
-	// use the official timestamp on success
-	message.Timestamp = ID
-	conv.CaughtUp()
-	message.AddAttachments(conv.stagedAttachments)
-	conv.ClearStaged()
-	conv.AddMessage(message)
+	conv := s.conversationFor(contact)
+	conv.ExpiresIn = seconds
 	s.NewInfo(conv)
-	log.Infof("successfully sent message %s with timestamp: %d", message.Content, message.Timestamp)
 	return nil
 }
 
-func (s *Siggo) newConversation(contact *Contact) *Conversation {
-	conv := NewConversation(contact)
-	s.conversations[contact] = conv
+// onExpirationUpdate handles someone changing the disappearing message timer
+func (s *Siggo) onExpirationUpdate(msg *signal.Message) error {
+	dataMsg := msg.Envelope.DataMessage
+	conv := s.conversationFor(s.contactFor(msg.Envelope.Source))
+	if dataMsg.GroupInfo != nil {
+		conv = s.conversationFor(s.groupFor(dataMsg.GroupInfo))
+	}
+	log.Infof("disappearing message timer for %v set to %s", conv.Contact, FormatTimer(dataMsg.ExpiresInSeconds))
+	conv.ExpiresIn = dataMsg.ExpiresInSeconds
+	s.NewInfo(conv)
+	return nil
+}
+
+// onExpirationUpdateSent handles us changing the disappearing message timer from another device
+func (s *Siggo) onExpirationUpdateSent(msg *signal.Message) error {
+	sentMsg := msg.Envelope.SyncMessage.SentMessage
+	var conv *Conversation
+	if sentMsg.GroupInfo != nil {
+		conv = s.conversationFor(s.groupFor(sentMsg.GroupInfo))
+	} else {
+		conv = s.conversationFor(s.contactFor(sentMsg.Destination))
+	}
+	log.Infof("disappearing message timer for %v set to %s", conv.Contact, FormatTimer(sentMsg.ExpiresInSeconds))
+	conv.ExpiresIn = sentMsg.ExpiresInSeconds
+	s.NewInfo(conv)
+	return nil
+}
+
+// CaughtUp marks the conversation with `contact` as read, and sends read receipts for anything
+// we hadn't read yet. Call it whenever we look at a conversation.
+func (s *Siggo) CaughtUp(contact *Contact) {
+	conv := s.conversationFor(contact)
+	read := conv.CaughtUp()
+	// receipts go to whoever sent each message, even in groups
+	bySender := make(map[PhoneNumber][]int64)
+	for _, msg := range read {
+		if msg.ReceiptSent || msg.FromContact == nil || !s.wantsReadReceipts(msg.FromContact) {
+			continue
+		}
+		bySender[msg.FromContact.Number] = append(bySender[msg.FromContact.Number], msg.Timestamp)
+	}
+	if len(bySender) == 0 {
+		return
+	}
+	// the outbox takes it from here, so receipts that fail are tried again, even after a restart
+	receipts := make([]*OutgoingMessage, 0, len(bySender))
+	for sender, timestamps := range bySender {
+		o := &OutgoingMessage{
+			ID:      time.Now().UnixNano() / 1000000,
+			To:      contact.Number,
+			IsGroup: contact.isGroup,
+			Receipt: &OutgoingReceipt{Sender: sender, Timestamps: timestamps},
+			conv:    conv,
+		}
+		s.queue(o)
+		receipts = append(receipts, o)
+	}
+	go func() {
+		for _, o := range receipts {
+			if err := s.sendOutgoing(o); err != nil {
+				log.Warnf("failed to send read receipts to %s: %v", o.Receipt.Sender, err)
+			}
+		}
+	}()
+}
+
+// wantsReadReceipts returns whether we send read receipts to `contact`
+func (s *Siggo) wantsReadReceipts(contact *Contact) bool {
+	for _, key := range []string{contact.Number, contact.Name, contact.String()} {
+		if send, ok := s.config.ReadReceiptOverrides[key]; ok {
+			return send
+		}
+	}
+	return s.config.SendReadReceipts
+}
+
+// Typing tells `contact` whether we are typing to them. We only tell them again about every
+// `typingResend` while typing continues, and only say we stopped if we said we started.
+func (s *Siggo) Typing(contact *Contact, typing bool) {
+	if s.config.DisableTypingIndicators {
+		return
+	}
+	conv := s.conversationFor(contact)
+	if !conv.tellTyping(typing) {
+		return
+	}
+	go func() {
+		if err := s.signal.SendTyping(contact.Number, contact.isGroup, !typing); err != nil {
+			log.Warnf("failed to send typing indicator to %v: %v", contact, err)
+		}
+	}()
+}
+
+// tellTyping records that we are telling the contact whether we are typing, and returns false if
+// there is no need to tell them
+func (c *Conversation) tellTyping(typing bool) bool {
+	c.typingLock.Lock()
+	defer c.typingLock.Unlock()
+	if typing {
+		if time.Since(c.typingSent) < typingResend {
+			return false
+		}
+		c.typingSent = time.Now()
+	} else {
+		if c.typingSent.IsZero() {
+			return false
+		}
+		c.typingSent = time.Time{}
+	}
+	return true
+}
+
+// conversationFor returns the conversation with a contact, starting a new one if needed
+func (s *Siggo) conversationFor(contact *Contact) *Conversation {
+	s.conversationsLock.Lock()
+	defer s.conversationsLock.Unlock()
+	conv, ok := s.conversations[contact]
+	if !ok {
+		log.Infof("new conversation for contact: %v", contact)
+		conv = NewConversation(contact)
+		conv.folder = s.conversationFolder()
+		s.conversations[contact] = conv
+	}
 	return conv
 }
 
-func (s *Siggo) newContact(number string) *Contact {
-	contact := &Contact{
-		Number: number,
+// contact returns the contact or group with a number, if we have one
+func (s *Siggo) contact(number string) (*Contact, bool) {
+	s.contactsLock.RLock()
+	defer s.contactsLock.RUnlock()
+	c, ok := s.contacts[number]
+	return c, ok
+}
+
+// contactFor returns the contact for a number, adding a new one if we haven't seen it before
+func (s *Siggo) contactFor(number string) *Contact {
+	s.contactsLock.Lock()
+	defer s.contactsLock.Unlock()
+	c, ok := s.contacts[number]
+	if !ok {
+		c = &Contact{
+			Number: number,
+		}
+		log.Infof("New contact: %v", c)
+		s.contacts[number] = c
 	}
-	s.contacts[number] = contact
-	return contact
+	return c
+}
+
+// groupFor returns the contact for a group, adding a new one if we haven't seen it before
+func (s *Siggo) groupFor(info *signal.GroupInfo) *Contact {
+	s.contactsLock.Lock()
+	defer s.contactsLock.Unlock()
+	g, ok := s.contacts[info.GroupID]
+	if !ok {
+		g = &Contact{
+			Number:  info.GroupID,
+			Name:    info.Name,
+			isGroup: true,
+		}
+		log.Infof("New group: %v", g)
+		s.contacts[g.Number] = g
+	}
+	return g
+}
+
+// findByUUID finds a contact by UUID, see ContactList.FindByUUID
+func (s *Siggo) findByUUID(uuid string) *Contact {
+	s.contactsLock.RLock()
+	defer s.contactsLock.RUnlock()
+	return s.contacts.FindByUUID(uuid)
+}
+
+// lookup finds a contact or group by name or number, see ContactList.Lookup
+func (s *Siggo) lookup(nameOrNumber string) *Contact {
+	s.contactsLock.RLock()
+	defer s.contactsLock.RUnlock()
+	return s.contacts.Lookup(nameOrNumber)
 }
 
 func (s *Siggo) handleError(err error) {
@@ -558,43 +1630,129 @@ func (s *Siggo) Receive() error {
 func (s *Siggo) ReceiveForever() {
 	go func() {
 		<-s.initialized
+		go s.sweepForever()
+		go s.retryForever()
 		s.signal.ReceiveForever()
 	}()
 }
 
+// conversationList returns all of the conversations, safe to use while new ones are added
+func (s *Siggo) conversationList() []*Conversation {
+	s.conversationsLock.RLock()
+	defer s.conversationsLock.RUnlock()
+	convs := make([]*Conversation, 0, len(s.conversations))
+	for _, conv := range s.conversations {
+		convs = append(convs, conv)
+	}
+	return convs
+}
+
+// onReadSync marks messages that we read on another device as read. We only get the sender and
+// timestamp, so we look through every conversation since it could be a group message.
+func (s *Siggo) onReadSync(msg *signal.Message) error {
+	now := time.Now()
+	for _, read := range msg.Envelope.SyncMessage.ReadMessages {
+		sender := read.Sender
+		if sender == "" {
+			if c := s.findByUUID(read.SenderUUID); c != nil {
+				sender = c.Number
+			}
+		}
+		found := false
+		for _, conv := range s.conversationList() {
+			if conv.markRead(sender, read.Timestamp, now) {
+				found = true
+				s.NewInfo(conv)
+				break
+			}
+		}
+		if !found {
+			log.Debugf("read sync for message we don't have: %s %d", sender, read.Timestamp)
+		}
+	}
+	return nil
+}
+
+// sweepForever periodically cleans up anything that goes stale on its own, like typing
+// indicators and disappearing messages
+func (s *Siggo) sweepForever() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.sweep(now)
+	}
+}
+
+// sweep expires typing indicators that are older than `TypingTimeout` at `now`, and removes
+// disappearing messages whose time is up from memory and from disk
+func (s *Siggo) sweep(now time.Time) {
+	for _, conv := range s.conversationList() {
+		changed := conv.expireTyping(now)
+		if conv.expireMessages(now) {
+			changed = true
+			if s.config.SaveMessages {
+				if err := conv.Save(); err != nil {
+					log.Errorf("failed to save conversation: %v", err)
+				}
+			}
+		}
+		if changed {
+			s.NewInfo(conv)
+		}
+	}
+}
+
+// onTyping tracks who is typing in which conversation
+func (s *Siggo) onTyping(msg *signal.Message) error {
+	typingMsg := msg.Envelope.TypingMessage
+	c := s.contactFor(msg.Envelope.Source)
+	conv := s.conversationFor(c)
+	if typingMsg.GroupID != "" {
+		conv = s.conversationFor(s.groupFor(&signal.GroupInfo{GroupID: typingMsg.GroupID}))
+	}
+	conv.SetTyping(c, typingMsg.Action == signal.TypingStarted)
+	s.NewInfo(conv)
+	return nil
+}
+
 func (s *Siggo) onSent(msg *signal.Message) error {
 	// add new message to conversation
 	sentMsg := msg.Envelope.SyncMessage.SentMessage
+	if sentMsg.Reaction != nil {
+		return s.onReactionSent(msg)
+	}
+	if sentMsg.RemoteDelete != nil {
+		return s.onRemoteDeleteSent(msg)
+	}
+	if sentMsg.EditMessage != nil {
+		return s.onEditSent(msg)
+	}
+	if sentMsg.IsExpirationUpdate {
+		return s.onExpirationUpdateSent(msg)
+	}
 
 	if sentMsg.GroupInfo != nil {
 		return s.onGroupMessageSent(msg)
 	}
 
-	contactNumber := sentMsg.Destination
-	// if we have a name for this contact, use it
-	// otherwise it will be the phone number
-	c, ok := s.contacts[contactNumber]
-	if !ok {
-		c = &Contact{
-			Number: contactNumber,
-		}
-		log.Infof("New contact: %v", c)
-		s.contacts[c.Number] = c
-	}
+	c := s.contactFor(sentMsg.Destination)
+	content, mentions := s.convertMentions(sentMsg.Message, sentMsg.Mentions)
 	message := &Message{
-		Content:     sentMsg.Message,
+		Content:     content,
 		From:        " ~ ",
 		Timestamp:   sentMsg.Timestamp,
 		IsDelivered: false,
 		IsRead:      false,
 		FromSelf:    true,
+		Mentions:    mentions,
 		Attachments: ConvertAttachments(sentMsg.Attachments, sentMsg.Timestamp, true),
+		Quote:       s.convertQuote(sentMsg.Quote),
+		ExpiresIn:   sentMsg.ExpiresInSeconds,
 	}
-	conv, ok := s.conversations[c]
-	if !ok {
-		log.Infof("new conversation for contact: %v", c)
-		conv = s.newConversation(c)
-	}
+	message.startExpiry(time.Now())
+	s.addMedia(message, sentMsg.Sticker, sentMsg.ViewOnce)
+	conv := s.conversationFor(c)
+	conv.ExpiresIn = sentMsg.ExpiresInSeconds
 	conv.AddMessage(message)
 	s.NewInfo(conv)
 	return nil
@@ -603,28 +1761,25 @@ func (s *Siggo) onSent(msg *signal.Message) error {
 func (s *Siggo) onReceived(msg *signal.Message) error {
 	// add new message to conversation
 	receiveMsg := msg.Envelope.DataMessage
+	if receiveMsg.Reaction != nil {
+		return s.onReactionReceived(msg)
+	}
+	if receiveMsg.RemoteDelete != nil {
+		return s.onRemoteDelete(msg)
+	}
+	if receiveMsg.IsExpirationUpdate {
+		return s.onExpirationUpdate(msg)
+	}
 	if receiveMsg.GroupInfo != nil {
 		return s.onGroupMessageReceived(msg)
 	}
 	contactNumber := msg.Envelope.Source
 	// if we have a name for this contact, use it
 	// otherwise it will be the phone number
-	c, ok := s.contacts[contactNumber]
-
-	var fromStr string
-	// TODO: fix this when i can load contact names from
-	// somewhere
-	if !ok {
+	c := s.contactFor(contactNumber)
+	fromStr := c.Name
+	if fromStr == "" {
 		fromStr = contactNumber
-		c = &Contact{
-			Number: contactNumber,
-		}
-		log.Infof("New contact: %v", c)
-		s.contacts[c.Number] = c
-	} else if c.Name == "" {
-		fromStr = contactNumber
-	} else {
-		fromStr = c.Name
 	}
 	message := &Message{
 		Content:     receiveMsg.Message,
@@ -634,34 +1789,79 @@ func (s *Siggo) onReceived(msg *signal.Message) error {
 		IsRead:      false,
 		Attachments: ConvertAttachments(receiveMsg.Attachments, receiveMsg.Timestamp, false),
 		FromContact: c,
+		Quote:       s.convertQuote(receiveMsg.Quote),
+		ExpiresIn:   receiveMsg.ExpiresInSeconds,
 	}
-	conv, ok := s.conversations[c]
-	if !ok {
-		log.Infof("new conversation for contact: %v", c)
-		conv = s.newConversation(c)
-	}
+	s.addMedia(message, receiveMsg.Sticker, receiveMsg.ViewOnce)
+	conv := s.conversationFor(c)
+	conv.ExpiresIn = receiveMsg.ExpiresInSeconds
+	conv.SetTyping(c, false)
 	conv.AddMessage(message)
 	s.NewInfo(conv)
 	s.sendNotification(c.String(), message.Content, c.Avatar())
 	return nil
 }
 
-func (s *Siggo) onReceipt(msg *signal.Message) error {
-	receiptMsg := msg.Envelope.ReceiptMessage
-	// if the message exists, edit it with new data
-	contactNumber := msg.Envelope.Source
-	// if we have a name for this contact, use it
-	// otherwise it will be the phone number
-	c, ok := s.contacts[contactNumber]
-	if !ok {
-		c = s.newContact(contactNumber)
+// onReactionReceived applies a reaction from someone else to the message it targets
+func (s *Siggo) onReactionReceived(msg *signal.Message) error {
+	dataMsg := msg.Envelope.DataMessage
+	c := s.contactFor(msg.Envelope.Source)
+	conv := s.conversationFor(c)
+	if dataMsg.GroupInfo != nil {
+		conv = s.conversationFor(s.groupFor(dataMsg.GroupInfo))
 	}
-	conv, ok := s.conversations[c]
+	message := s.applyReaction(conv, c.Number, c.String(), dataMsg.Reaction, dataMsg.Timestamp)
+	if message != nil && message.FromSelf && !dataMsg.Reaction.IsRemove {
+		content := fmt.Sprintf("reacted %s to: %s", dataMsg.Reaction.Emoji, message.Content)
+		s.sendNotification(conv.Contact.String(), content, c.Avatar())
+	}
+	return nil
+}
+
+// onReactionSent applies a reaction that we sent from another device
+func (s *Siggo) onReactionSent(msg *signal.Message) error {
+	sentMsg := msg.Envelope.SyncMessage.SentMessage
+	var conv *Conversation
+	if sentMsg.GroupInfo != nil {
+		conv = s.conversationFor(s.groupFor(sentMsg.GroupInfo))
+	} else {
+		conv = s.conversationFor(s.contactFor(sentMsg.Destination))
+	}
+	s.applyReaction(conv, s.config.UserNumber, SelfName, sentMsg.Reaction, sentMsg.Timestamp)
+	return nil
+}
+
+// applyReaction adds or removes a reaction to a message in `conv`. Returns the message that was
+// reacted to, or nil if we don't have it.
+func (s *Siggo) applyReaction(conv *Conversation, number PhoneNumber, from string, reaction *signal.Reaction, timestamp int64) *Message {
+	conv.messageLock.Lock()
+	message, ok := conv.Messages[reaction.TargetSentTimestamp]
 	if !ok {
-		conv = s.newConversation(c)
+		conv.messageLock.Unlock()
+		log.Warnf("reaction to message we don't have: %d", reaction.TargetSentTimestamp)
+		return nil
+	}
+	if reaction.IsRemove {
+		message.RemoveReaction(number)
+	} else {
+		message.AddReaction(number, &Reaction{
+			Emoji:     reaction.Emoji,
+			From:      from,
+			Timestamp: timestamp,
+		})
 	}
+	conv.hasNewData = true
+	conv.messageLock.Unlock()
+	s.NewInfo(conv)
+	return message
+}
+
+func (s *Siggo) onReceipt(msg *signal.Message) error {
+	receiptMsg := msg.Envelope.ReceiptMessage
+	// if the message exists, edit it with new data
+	conv := s.conversationFor(s.contactFor(msg.Envelope.Source))
 	for _, ts := range receiptMsg.Timestamps {
-		message, ok := conv.Messages[ts]
+		message, ok := conv.message(ts)
 		if !ok {
 			// TODO: handle case where we get a read receipt for
 			// a message that we don't have
@@ -691,101 +1891,72 @@ func (s *Siggo) onGroupMessageReceived(msg *signal.Message) error {
 	// add new message to conversation
 	receiveMsg := msg.Envelope.DataMessage
 	contactNumber := msg.Envelope.Source
-	groupID := msg.Envelope.DataMessage.GroupInfo.GroupID
-	groupName := msg.Envelope.DataMessage.GroupInfo.Name
-
-	g, ok := s.contacts[groupID]
-
-	if !ok {
-		// group not in contacts
-		g = &Contact{
-			Number:  groupID,
-			Name:    groupName,
-			isGroup: true,
-		}
-		log.Infof("New group: %v", g)
-		s.contacts[g.Number] = g
-	}
+	g := s.groupFor(receiveMsg.GroupInfo)
 
 	var fromStr string
-	c, ok := s.contacts[contactNumber]
-	if !ok {
-		// number not currently in contacts
-		c = s.newContact(contactNumber)
-		log.Infof("New contact: %v", c)
-		fromStr = contactNumber
-	} else if c.Name == "" {
+	c := s.contactFor(contactNumber)
+	if c.Name == "" {
 		fromStr = contactNumber
 	} else {
 		fromStr = c.Name
 	}
 	log.Debugf("new group message for group %v from contact %v", g, c)
+	s.addMembers(g, c.Number)
+	s.addMembers(g, msg.Envelope.DataMessage.GroupInfo.Members...)
 
+	content, mentions := s.convertMentions(receiveMsg.Message, receiveMsg.Mentions)
 	message := &Message{
-		Content:     receiveMsg.Message,
+		Content:     content,
+		Mentions:    mentions,
 		From:        fromStr,
 		Timestamp:   receiveMsg.Timestamp,
 		IsDelivered: true,
 		IsRead:      false,
 		Attachments: ConvertAttachments(receiveMsg.Attachments, receiveMsg.Timestamp, false),
 		FromContact: c,
+		Quote:       s.convertQuote(receiveMsg.Quote),
+		ExpiresIn:   receiveMsg.ExpiresInSeconds,
 	}
+	s.addMedia(message, receiveMsg.Sticker, receiveMsg.ViewOnce)
 
-	conv, ok := s.conversations[g]
-	if !ok {
-		log.Infof("new conversation for group: %v", g)
-		conv = s.newConversation(g)
-	}
+	conv := s.conversationFor(g)
+	conv.ExpiresIn = receiveMsg.ExpiresInSeconds
+	conv.SetTyping(c, false)
 	conv.AddMessage(message)
 	s.NewInfo(conv)
-	s.sendNotification(g.String(), message.Content, c.Avatar())
+	// quiet groups only notify us when someone mentions us
+	if !s.isQuiet(g) || s.mentionsUs(mentions) {
+		s.sendNotification(g.String(), message.Content, c.Avatar())
+	}
 	return nil
 }
 
 func (s *Siggo) onGroupMessageSent(msg *signal.Message) error {
 	// add new message to conversation
 	sentMsg := msg.Envelope.SyncMessage.SentMessage
-	contactNumber := msg.Envelope.Source
-	groupID := msg.Envelope.SyncMessage.SentMessage.GroupInfo.GroupID
-	groupName := msg.Envelope.SyncMessage.SentMessage.GroupInfo.Name
-
-	g, ok := s.contacts[groupID]
-
-	if !ok {
-		// group not in contacts
-		g = &Contact{
-			Number:  groupID,
-			Name:    groupName,
-			isGroup: true,
-		}
-		log.Infof("New group: %v", g)
-		s.contacts[g.Number] = g
-	}
-
-	c, ok := s.contacts[contactNumber]
-	if !ok {
-		// number not currently in contacts
-		c = s.newContact(contactNumber)
-		log.Infof("New contact: %v", c)
-	}
+	g := s.groupFor(sentMsg.GroupInfo)
+	c := s.contactFor(msg.Envelope.Source)
 	log.Debugf("new group message for group %v from contact %v", g, c)
 
+	content, mentions := s.convertMentions(sentMsg.Message, sentMsg.Mentions)
 	message := &Message{
-		Content:     sentMsg.Message,
+		Content:     content,
 		From:        " ~ ",
 		Timestamp:   sentMsg.Timestamp,
 		IsDelivered: false,
 		IsRead:      false,
 		FromSelf:    true,
+		Mentions:    mentions,
 		Attachments: ConvertAttachments(sentMsg.Attachments, sentMsg.Timestamp, false),
 		FromContact: c,
+		Quote:       s.convertQuote(sentMsg.Quote),
+		ExpiresIn:   sentMsg.ExpiresInSeconds,
 	}
+	message.startExpiry(time.Now())
+	s.addMedia(message, sentMsg.Sticker, sentMsg.ViewOnce)
 
-	conv, ok := s.conversations[g]
-	if !ok {
-		log.Infof("new conversation for group: %v", g)
-		conv = s.newConversation(g)
-	}
+	conv := s.conversationFor(g)
+	conv.ExpiresIn = sentMsg.ExpiresInSeconds
 	conv.AddMessage(message)
 	s.NewInfo(conv)
 	return nil
@@ -810,14 +1981,67 @@ func (s *Siggo) sendNotification(title, content, iconPath string) {
 	}
 }
 
-// Conversations returns the current converstation book
+// Conversations returns a copy of the current converstation book
 func (s *Siggo) Conversations() map[*Contact]*Conversation {
-	return s.conversations
+	s.conversationsLock.RLock()
+	defer s.conversationsLock.RUnlock()
+	convs := make(map[*Contact]*Conversation, len(s.conversations))
+	for contact, conv := range s.conversations {
+		convs[contact] = conv
+	}
+	return convs
 }
 
-// Contacts returns the current contact list
+// Contacts returns a copy of the current contact list
 func (s *Siggo) Contacts() ContactList {
-	return s.contacts
+	s.contactsLock.RLock()
+	defer s.contactsLock.RUnlock()
+	contacts := make(ContactList, len(s.contacts))
+	for number, c := range s.contacts {
+		contacts[number] = c
+	}
+	return contacts
+}
+
+// Account returns the account this model is for
+func (s *Siggo) Account() Account {
+	return s.config.Account()
+}
+
+// UnreadCount returns how many messages we haven't read yet, in all conversations
+func (s *Siggo) UnreadCount() int {
+	count := 0
+	for _, conv := range s.conversationList() {
+		count += conv.UnreadCount()
+	}
+	return count
+}
+
+// conversationFolder returns where conversations are saved for our account
+func (s *Siggo) conversationFolder() string {
+	return AccountConversationFolder(s.config.UserNumber)
+}
+
+// migrateConversations moves conversations saved before siggo supported more than one account
+// into the folder for our account, if it doesn't have one yet. The first account to start gets
+// them, which is always UserNumber.
+func (s *Siggo) migrateConversations() {
+	legacy, folder := ConversationFolder(), s.conversationFolder()
+	if _, err := os.Stat(legacy); err != nil {
+		return
+	}
+	if _, err := os.Stat(folder); err == nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(folder), os.ModePerm); err != nil {
+		log.Warnf("failed to migrate conversations: %v", err)
+		return
+	}
+	if err := os.Rename(legacy, folder); err != nil {
+		log.Warnf("failed to migrate conversations: %v", err)
+		return
+	}
+	log.Infof("moved conversations from %s to %s", legacy, folder)
 }
 
 // Config returns a copy of the current configuration
@@ -827,7 +2051,7 @@ func (s *Siggo) Config() Config {
 
 // SaveConversations saves all conversations to disk
 func (s *Siggo) SaveConversations() {
-	for _, conv := range s.conversations {
+	for _, conv := range s.conversationList() {
 		err := conv.Save()
 		if err != nil {
 			log.Errorf("failed to save conversation: %v", err)
@@ -840,6 +2064,7 @@ func (s *Siggo) Quit() {
 	if s.config.SaveMessages {
 		s.SaveConversations()
 	}
+	s.deleteAllViewed()
 	s.signal.Close() // kills the signal-cli daemon
 }
 
@@ -849,38 +2074,58 @@ func NewSiggo(sig SignalAPI, config *Config) *Siggo {
 		config:      config,
 		signal:      sig,
 		initialized: make(chan bool),
+		calls:       make(map[int64]*call),
+		viewed:      make(map[string]bool),
 
-		NewInfo:    func(*Conversation) {}, // noop
-		ErrorEvent: func(error) {},         // noop
+		NewInfo:     func(*Conversation) {},    // noop
+		ErrorEvent:  func(error) {},            // noop
+		StateChange: func(signal.ConnState) {}, // noop
 	}
 	s.init()
 	//sig.OnMessage(s.?)
 
 	sig.OnSent(s.onSent)
-	sig.OnReceived(s.onReceived)
+	sig.OnReceived(s.unlessBlocked(s.onReceived))
 	sig.OnReceipt(s.onReceipt)
 	sig.OnError(s.handleError)
+	sig.OnTyping(s.unlessBlocked(s.onTyping))
+	sig.OnReadSync(s.onReadSync)
+	sig.OnCall(s.unlessBlocked(s.onCall))
+	sig.OnEdit(s.unlessBlocked(s.onEdit))
+	sig.OnStateChange(func(state signal.ConnState) {
+		if state == signal.ConnConnected {
+			s.wakeOutbox()
+		}
+		s.StateChange(state)
+	})
 	return s
 }
 
 func (s *Siggo) init() {
 	//load contacts and conversations for the first time
-	s.contacts = s.getContacts()
-	if self, ok := s.contacts[s.config.UserNumber]; ok {
+	contacts := s.getContacts()
+	if self, ok := contacts[s.config.UserNumber]; ok {
 		self.Name = s.config.UserName
 	}
-	s.conversations = s.getConversations()
+	s.contactsLock.Lock()
+	s.contacts = contacts
+	s.contactsLock.Unlock()
+	s.migrateConversations()
+	conversations := s.getConversations()
+	s.conversationsLock.Lock()
+	s.conversations = conversations
+	s.conversationsLock.Unlock()
+	s.removeViewedMedia()
+	s.loadOutbox()
 	go s.refreshGroupNames() // will signal s.initialized when finished
 }
 
 // getContacts reads a fresh contact list from disk for the configured user
 func (s *Siggo) getContacts() ContactList {
 	list := make(ContactList)
-	sig := signal.NewSignal(s.config.UserNumber)
 	highestIndex := 0
-
 	// get all contacts from disk
-	contacts, err := sig.GetContactList()
+	contacts, err := s.signal.GetContactList()
 	if err != nil {
 		log.Warnf("failed to read contacts from disk: %v", err)
 		return list
@@ -896,36 +2141,43 @@ func (s *Siggo) getContacts() ContactList {
 		// check if we have a color for this contact
 		color := s.config.ContactColors[name]
 		contact := &Contact{
-			Number: c.Number,
-			Name:   name,
-			Index:  highestIndex,
-			alias:  alias,
-			color:  color,
+			Number:  c.Number,
+			Name:    name,
+			Index:   highestIndex,
+			UUID:    c.UUID,
+			alias:   alias,
+			color:   color,
+			blocked: c.Blocked,
 		}
 		list[c.Number] = contact
 		highestIndex++
 	}
 
 	// get all groups from disk
-	groups, err := sig.GetGroupList()
+	groups, err := s.signal.GetGroupList()
 	if err != nil {
 		log.Warnf("failed to read groups from disk: %v", err)
 		return list
 	}
 	for _, g := range groups {
-		if !g.Blocked {
-			alias := ""
-			if s.config.ContactAliases != nil {
-				alias = s.config.ContactAliases[g.GroupID]
-			}
-			highestIndex++
-			list[g.GroupID] = &Contact{
-				Number:  g.GroupID,
-				Name:    g.GroupID, // we <currently> have to make another call to get the name
-				Index:   highestIndex,
-				alias:   alias,
-				isGroup: true,
-			}
+		alias := ""
+		if s.config.ContactAliases != nil {
+			alias = s.config.ContactAliases[g.GroupID]
+		}
+		// older versions of signal-cli don't save the name, so we may have to make another
+		// call to get it
+		name := g.Name
+		if name == "" {
+			name = g.GroupID
+		}
+		highestIndex++
+		list[g.GroupID] = &Contact{
+			Number:  g.GroupID,
+			Name:    name,
+			Index:   highestIndex,
+			alias:   alias,
+			isGroup: true,
+			blocked: g.Blocked,
 		}
 	}
 	return list
@@ -934,12 +2186,13 @@ func (s *Siggo) getContacts() ContactList {
 // getConversations reads conversations from disk for the configured user's contact list
 func (s *Siggo) getConversations() map[*Contact]*Conversation {
 	conversations := make(map[*Contact]*Conversation)
-	for _, contact := range s.contacts {
+	for _, contact := range s.Contacts() {
 		log.Debugf("Adding conversation for: %+v\n", contact)
 		conv := NewConversation(contact)
+		conv.folder = s.conversationFolder()
 		// check if we have a conversation file for this contact
 		if s.config.SaveMessages {
-			convPath := filepath.Join(ConversationFolder(), contact.Number)
+			convPath := filepath.Join(conv.folder, contact.Number)
 			err := conv.Load(convPath, s.config) // if we fail to load, oh well
 			if err == nil {
 				log.Infof("loaded conversation from: %s", contact.Name)
@@ -964,9 +2217,12 @@ func (s *Siggo) refreshGroupNames() {
 	}
 	for _, group := range info {
 		log.Printf("groups found: %+v", group)
-		if s.contacts[group.ID] != nil {
+		if g, ok := s.contact(group.ID); ok {
 			log.Printf("replacing group %s with '%s'", group.ID, group.Name)
-			s.contacts[group.ID].Name = group.Name
+			g.Name = group.Name
+			for _, member := range group.Members {
+				s.addMembers(g, member.Number)
+			}
 			s.NewInfo(nil)
 		}
 	}
@@ -0,0 +1,759 @@
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/derricw/siggo/signal"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testUser    = "+15555555550"
+	testContact = "+15555555551"
+)
+
+// newTestSiggo returns a siggo model on top of the mock backend, with its data and config folders
+// pointed somewhere temporary.
+func newTestSiggo(t *testing.T) (*Siggo, *signal.MockSignal) {
+	dir, err := ioutil.TempDir("", "siggo-model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldXDG := os.Getenv("XDG_DATA_HOME")
+	oldConfig := os.Getenv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_DATA_HOME", dir)
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	t.Cleanup(func() {
+		os.Setenv("XDG_DATA_HOME", oldXDG)
+		os.Setenv("XDG_CONFIG_HOME", oldConfig)
+		os.RemoveAll(dir)
+	})
+	cfg := DefaultConfig()
+	cfg.UserNumber = testUser
+	mock := signal.NewMockSignal(testUser, []byte{})
+	return NewSiggo(mock, cfg), mock
+}
+
+// receive puts wire messages on the mock wire and processes them
+func receive(t *testing.T, mock *signal.MockSignal, wire ...string) {
+	for _, w := range wire {
+		if err := mock.ProcessWire([]byte(w)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testConversation(s *Siggo, number string) *Conversation {
+	return s.Conversations()[s.Contacts()[number]]
+}
+
+func TestReactions(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":100,"dataMessage":{"timestamp":100,"message":"hello"}}}`,
+		`{"envelope":{"source":"+15555555551","timestamp":101,"dataMessage":{"timestamp":101,
+			"reaction":{"emoji":"👍","targetAuthor":"+15555555551","targetSentTimestamp":100,"isRemove":false}}}}`,
+	)
+	conv := testConversation(s, testContact)
+	assert.Equal(t, 1, len(conv.MessageOrder), "reactions shouldn't show up as messages")
+	msg := conv.Messages[100]
+	assert.Equal(t, "👍", msg.Reactions[testContact].Emoji)
+	assert.True(t, strings.Contains(msg.String(), "👍 +15555555551"))
+
+	// our own reaction, from the UI
+	assert.Nil(t, s.React(conv.Contact, msg, "❤"))
+	assert.Equal(t, "❤", msg.Reactions[testUser].Emoji)
+	assert.Nil(t, s.React(conv.Contact, msg, ""))
+	_, ok := msg.Reactions[testUser]
+	assert.False(t, ok)
+
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":102,"dataMessage":{"timestamp":102,
+			"reaction":{"emoji":"👍","targetAuthor":"+15555555551","targetSentTimestamp":100,"isRemove":true}}}}`,
+	)
+	assert.Equal(t, 0, len(msg.Reactions))
+}
+
+func TestQuotes(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":100,"dataMessage":{"timestamp":100,"message":"hello"}}}`,
+		`{"envelope":{"source":"+15555555551","timestamp":101,"dataMessage":{"timestamp":101,"message":"hello again",
+			"quote":{"id":100,"author":"+15555555551","authorNumber":"+15555555551","text":"hello"}}}}`,
+	)
+	conv := testConversation(s, testContact)
+	reply := conv.Messages[101]
+	assert.Equal(t, int64(100), reply.Quote.ID)
+	assert.Equal(t, testContact, reply.Quote.Author)
+	assert.Equal(t, "hello", reply.Quote.Text)
+	assert.True(t, strings.Contains(reply.String(), "┌ +15555555551: hello"))
+
+	// our reply, from the UI
+	conv.StageQuote(reply)
+	assert.Nil(t, s.Send("hi", conv.Contact))
+	assert.Nil(t, conv.StagedQuote())
+	sent := conv.LastMessage()
+	assert.Equal(t, int64(101), sent.Quote.ID)
+	assert.Equal(t, testContact, sent.Quote.Author)
+
+	// long quotes are cut between characters, not in the middle of one
+	long := &Quote{From: "Bob", Text: strings.Repeat("🐱", maxQuoteLength+1)}
+	assert.True(t, utf8.ValidString(long.String()))
+	assert.True(t, strings.HasSuffix(long.String(), strings.Repeat("🐱", maxQuoteLength)+"…"))
+}
+
+func TestTyping(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":100,"typingMessage":{"action":"STARTED","timestamp":100}}}`,
+	)
+	conv := testConversation(s, testContact)
+	assert.Equal(t, "+15555555551 is typing…", conv.TypingString())
+
+	// stale indicators are swept away
+	s.sweep(time.Now())
+	assert.Equal(t, 1, len(conv.Typing()))
+	s.sweep(time.Now().Add(TypingTimeout + time.Second))
+	assert.Equal(t, 0, len(conv.Typing()))
+
+	// a message from them means they stopped
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":101,"typingMessage":{"action":"STARTED","timestamp":101}}}`,
+		`{"envelope":{"source":"+15555555551","timestamp":102,"dataMessage":{"timestamp":102,"message":"hi"}}}`,
+	)
+	assert.Equal(t, "", conv.TypingString())
+}
+
+func TestRemoteDelete(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":100,"dataMessage":{"timestamp":100,"message":"oops"}}}`,
+		`{"envelope":{"source":"+15555555551","timestamp":101,"dataMessage":{"timestamp":101,
+			"remoteDelete":{"timestamp":100}}}}`,
+	)
+	conv := testConversation(s, testContact)
+	assert.Equal(t, 1, len(conv.MessageOrder))
+	msg := conv.Messages[100]
+	assert.True(t, msg.IsDeleted)
+	assert.Equal(t, DeletedContent, msg.Content)
+
+	// we can delete our own messages, but nobody else's
+	assert.Nil(t, s.Send("mine", conv.Contact))
+	mine := conv.LastMessage()
+	assert.Nil(t, s.DeleteForEveryone(conv.Contact, mine))
+	assert.True(t, mine.IsDeleted)
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":102,"dataMessage":{"timestamp":102,"message":"keep",
+			"groupInfo":{"groupId":"abc="}}}}`,
+		`{"envelope":{"source":"+15555555552","timestamp":103,"dataMessage":{"timestamp":103,
+			"groupInfo":{"groupId":"abc="},"remoteDelete":{"timestamp":102}}}}`,
+	)
+	group := testConversation(s, "abc=")
+	assert.False(t, group.Messages[102].IsDeleted)
+	assert.NotNil(t, s.DeleteForEveryone(group.Contact, group.Messages[102]))
+}
+
+func TestDisappearingMessages(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":100,"dataMessage":{"timestamp":100,"message":"psst",
+			"expiresInSeconds":60}}}`,
+	)
+	conv := testConversation(s, testContact)
+	assert.Equal(t, int64(60), conv.ExpiresIn)
+	assert.Equal(t, "1m", conv.TimerString())
+	msg := conv.Messages[100]
+	// the timer doesn't start until we read it
+	assert.Equal(t, int64(0), msg.ExpiresAt)
+	s.sweep(time.Now().Add(time.Hour))
+	assert.Equal(t, 1, len(conv.MessageOrder))
+
+	conv.CaughtUp()
+	assert.NotEqual(t, int64(0), msg.ExpiresAt)
+	s.sweep(time.Now())
+	assert.Equal(t, 1, len(conv.MessageOrder))
+	s.sweep(time.Now().Add(61 * time.Second))
+	assert.Equal(t, 0, len(conv.MessageOrder))
+	assert.Equal(t, 0, len(conv.Messages))
+
+	assert.Nil(t, s.SetExpiration(conv.Contact, 0))
+	assert.Equal(t, "", conv.TimerString())
+
+	// changing the timer on another device doesn't add a message
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555550","timestamp":200,"syncMessage":{"sentMessage":{"timestamp":200,
+			"destination":"+15555555551","expiresInSeconds":300,"isExpirationUpdate":true}}}}`,
+	)
+	assert.Equal(t, int64(300), conv.ExpiresIn)
+	assert.Equal(t, 0, len(conv.MessageOrder))
+}
+
+// TestSweepWhileReading runs the sweeper alongside the UI reading the conversation. Run it with
+// -race.
+func TestSweepWhileReading(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	s.config.SaveMessages = true
+	for i := 0; i < 50; i++ {
+		receive(t, mock, fmt.Sprintf(`{"envelope":{"source":"+15555555551","timestamp":%d,
+			"dataMessage":{"timestamp":%d,"message":"psst","expiresInSeconds":1}}}`, 100+i, 100+i))
+	}
+	conv := testConversation(s, testContact)
+	if err := os.MkdirAll(FindDataFolder(), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			s.sweep(time.Now().Add(time.Duration(i) * 100 * time.Millisecond))
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		s.CaughtUp(conv.Contact)
+		conv.LastMessage()
+		conv.MessageList()
+		assert.NoError(t, conv.SaveAs(filepath.Join(FindDataFolder(), "conv")))
+	}
+	<-done
+	s.sweep(time.Now().Add(time.Minute))
+	assert.Equal(t, 0, len(conv.MessageList()))
+}
+
+// TestContactsWhileReceiving changes contacts from the UI while the receive loop adds them. Run
+// it with -race.
+func TestContactsWhileReceiving(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			receive(t, mock, fmt.Sprintf(`{"envelope":{"source":"+1555555%04d","timestamp":%d,
+				"dataMessage":{"timestamp":%d,"message":"hi","groupInfo":{"groupId":"g%d="}}}}`,
+				i, 100+i, 100+i, i))
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		group, err := s.CreateGroup(fmt.Sprintf("club %d", i), []PhoneNumber{testContact})
+		assert.NoError(t, err)
+		s.Contacts().SortedByIndex()
+		assert.NoError(t, s.LeaveGroup(group))
+	}
+	<-done
+	for i := 0; i < 50; i++ {
+		assert.NotNil(t, s.Contacts()[fmt.Sprintf("+1555555%04d", i)])
+		assert.NotNil(t, s.Conversations()[s.Contacts()[fmt.Sprintf("g%d=", i)]])
+	}
+}
+
+func TestTimers(t *testing.T) {
+	for timer, seconds := range map[string]int64{"off": 0, "30s": 30, "5m": 300, "1h": 3600, "1d": 86400, "1w": 604800, "1h30m": 5400} {
+		parsed, err := ParseTimer(timer)
+		assert.Nil(t, err)
+		assert.Equal(t, seconds, parsed)
+		if seconds > 0 && timer != "1h30m" {
+			assert.Equal(t, timer, FormatTimer(seconds))
+		}
+	}
+	_, err := ParseTimer("soon")
+	assert.NotNil(t, err)
+}
+
+func TestMentions(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":100,"dataMessage":{"timestamp":100,
+			"message":"😀 ￼ look","groupInfo":{"groupId":"abc="},
+			"mentions":[{"number":"+15555555550","start":3,"length":1}]}}}`,
+	)
+	group := testConversation(s, "abc=")
+	msg := group.Messages[100]
+	assert.Equal(t, "😀 @self look", msg.Content)
+	assert.True(t, s.mentionsUs(msg.Mentions))
+	assert.True(t, strings.Contains(msg.String(), "[::bu]@self[::b]"))
+
+	// mentions by UUID are resolved against our contacts
+	s.Contacts()[testContact].UUID = "uuid-1"
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":101,"dataMessage":{"timestamp":101,
+			"message":"￼ hi","groupInfo":{"groupId":"abc="},
+			"mentions":[{"uuid":"uuid-1","start":0,"length":1}]}}}`,
+	)
+	assert.Equal(t, "@+15555555551 hi", group.Messages[101].Content)
+	assert.False(t, s.mentionsUs(group.Messages[101].Mentions))
+
+	// the sender is a member now, so we can mention them
+	wire, mentions := s.findMentions("😀 @+15555555551 hello", group.Contact)
+	assert.Equal(t, 1, len(wire))
+	assert.Equal(t, "3:13:+15555555551", wire[0].String())
+	assert.Equal(t, testContact, mentions[0].Number)
+
+	// without a name, we are mentioned by number
+	s.config.UserName = ""
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":102,"dataMessage":{"timestamp":102,
+			"message":"￼ hi","groupInfo":{"groupId":"abc="},
+			"mentions":[{"number":"+15555555550","start":0,"length":1}]}}}`,
+	)
+	assert.Equal(t, "@+15555555550 hi", group.Messages[102].Content)
+
+	// only the mentions themselves are highlighted, not text that looks like them
+	msg = &Message{
+		Content:  "@Bob @Bobby",
+		IsRead:   true,
+		Mentions: []*Mention{{Name: "Bobby", Start: 5, Length: 6}},
+	}
+	assert.Equal(t, "@Bob [::u]@Bobby[::-]", msg.highlightMentions())
+	msg.Mentions = []*Mention{{Name: "Bob", Start: 0, Length: 4}}
+	assert.Equal(t, "[::u]@Bob[::-] @Bobby", msg.highlightMentions())
+	_, mentions = s.findMentions("@+15555555551 and @+15555555551", group.Contact)
+	assert.Equal(t, 2, len(mentions))
+	assert.Equal(t, 18, mentions[1].Start)
+}
+
+func TestStickersAndViewOnce(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":100,"dataMessage":{"timestamp":100,
+			"sticker":{"packId":"abcd","stickerId":3,"emoji":"😀"}}}}`,
+		`{"envelope":{"source":"+15555555551","timestamp":101,"dataMessage":{"timestamp":101,"viewOnce":true,
+			"attachments":[{"contentType":"image/jpeg","filename":"secret.jpg","id":"secret","size":3}]}}}`,
+	)
+	conv := testConversation(s, testContact)
+	sticker := conv.Messages[100]
+	assert.True(t, strings.Contains(sticker.String(), "[sticker 😀]"))
+	assert.False(t, strings.Contains(sticker.String(), "📎"))
+	assert.True(t, strings.HasSuffix(sticker.Attachments[0].Filename, "stickers/abcd/3"))
+
+	// view-once media can be viewed once, then it's gone
+	folder, err := signal.GetSignalFolder()
+	assert.Nil(t, err)
+	assert.Nil(t, os.MkdirAll(folder+"/attachments", 0700))
+	assert.Nil(t, ioutil.WriteFile(folder+"/attachments/secret", []byte("shh"), 0600))
+	secret := conv.Messages[101].Attachments[0]
+	assert.True(t, secret.ViewOnce)
+	path, done, err := s.ViewAttachment(conv.Contact, secret)
+	assert.Nil(t, err)
+	done()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	_, _, err = s.ViewAttachment(conv.Contact, secret)
+	assert.NotNil(t, err)
+
+	// if we quit before the viewer is done, it is deleted anyway
+	assert.Nil(t, ioutil.WriteFile(folder+"/attachments/secret", []byte("shh"), 0600))
+	secret.Viewed = false
+	path, _, err = s.ViewAttachment(conv.Contact, secret)
+	assert.Nil(t, err)
+	s.Quit()
+	assert.NoFileExists(t, path)
+
+	// and if we didn't get to quit, it goes once we've loaded the conversation next time
+	assert.Nil(t, ioutil.WriteFile(path, []byte("shh"), 0600))
+	s.removeViewedMedia()
+	assert.NoFileExists(t, path)
+}
+
+func TestReadSync(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":100,"dataMessage":{"timestamp":100,"message":"one"}}}`,
+		`{"envelope":{"source":"+15555555551","timestamp":101,"dataMessage":{"timestamp":101,"message":"two"}}}`,
+	)
+	conv := testConversation(s, testContact)
+	assert.True(t, conv.HasNewMessage)
+
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555550","timestamp":102,"syncMessage":{
+			"readMessages":[{"sender":"+15555555551","timestamp":100}]}}}`,
+	)
+	assert.True(t, conv.Messages[100].IsRead)
+	assert.False(t, conv.Messages[101].IsRead)
+	assert.True(t, conv.HasNewMessage)
+
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555550","timestamp":103,"syncMessage":{
+			"readMessages":[{"sender":"+15555555551","timestamp":101}]}}}`,
+	)
+	assert.True(t, conv.Messages[101].IsRead)
+	assert.False(t, conv.HasNewMessage)
+}
+
+func TestReadReceipts(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	s.config.SendReadReceipts = true
+	s.config.ReadReceiptOverrides["+15555555552"] = false
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":100,"dataMessage":{"timestamp":100,"message":"one"}}}`,
+		`{"envelope":{"source":"+15555555552","timestamp":101,"dataMessage":{"timestamp":101,"message":"two"}}}`,
+	)
+	assert.True(t, s.wantsReadReceipts(s.Contacts()[testContact]))
+	assert.False(t, s.wantsReadReceipts(s.Contacts()["+15555555552"]))
+
+	conv := testConversation(s, testContact)
+	s.CaughtUp(conv.Contact)
+	msg := conv.Messages[100]
+	assert.True(t, msg.IsRead)
+	assert.Eventually(t, func() bool {
+		conv.messageLock.Lock()
+		defer conv.messageLock.Unlock()
+		return msg.ReceiptSent
+	}, time.Second, 10*time.Millisecond)
+
+	other := testConversation(s, "+15555555552")
+	s.CaughtUp(other.Contact)
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, other.Messages[101].ReceiptSent)
+
+	// receipts that fail to send stay in the outbox until they go out, even across a restart
+	flaky := &flakySignal{MockSignal: mock}
+	flaky.failReceipts(&signal.Error{Kind: signal.ErrDaemonNotRunning})
+	s = NewSiggo(flaky, s.config)
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":102,"dataMessage":{"timestamp":102,"message":"three"}}}`,
+	)
+	conv = s.conversationFor(s.contactFor(testContact))
+	s.CaughtUp(conv.Contact)
+	queued := func(s *Siggo) *OutgoingMessage {
+		s.outboxLock.Lock()
+		defer s.outboxLock.Unlock()
+		if len(s.outbox) != 1 || s.outbox[0].State != Queued {
+			return nil
+		}
+		return s.outbox[0]
+	}
+	assert.Eventually(t, func() bool { return queued(s) != nil }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, &OutgoingReceipt{Sender: testContact, Timestamps: []int64{102}}, queued(s).Receipt)
+
+	s = NewSiggo(flaky, s.config)
+	conv = s.conversationFor(s.contactFor(testContact))
+	conv.AddMessage(&Message{Timestamp: 102, IsRead: true, FromContact: conv.Contact})
+	assert.NotNil(t, queued(s))
+	flaky.failReceipts(nil)
+	s.retryOutbox(time.Now().Add(time.Hour))
+	msg, _ = conv.message(102)
+	assert.True(t, msg.ReceiptSent)
+	assert.Nil(t, queued(s))
+}
+
+func TestGroups(t *testing.T) {
+	s, _ := newTestSiggo(t)
+	members, err := s.Numbers([]string{testContact, " +15555555552"})
+	assert.NoError(t, err)
+	_, err = s.Numbers([]string{"nobody"})
+	assert.Error(t, err)
+
+	group, err := s.CreateGroup("club", members)
+	assert.NoError(t, err)
+	assert.True(t, group.IsGroup())
+	assert.Equal(t, group, s.Contacts().Lookup("club"))
+	assert.Equal(t, group, s.Contacts().Lookup(group.Number))
+	assert.NotNil(t, s.Conversations()[group])
+	assert.True(t, group.HasMember(testContact))
+
+	assert.NoError(t, s.UpdateGroup(group, &signal.GroupUpdate{
+		Name:          "book club",
+		RemoveMembers: []string{testContact},
+		AddMembers:    []string{"+15555555553"},
+	}))
+	assert.Equal(t, "book club", group.Name)
+	assert.False(t, group.HasMember(testContact))
+	assert.True(t, group.HasMember("+15555555553"))
+
+	notified := false
+	s.NewInfo = func(*Conversation) { notified = true }
+	assert.NoError(t, s.LeaveGroup(group))
+	assert.True(t, notified)
+	assert.Nil(t, s.Contacts().Lookup(group.Number))
+	assert.Nil(t, s.Conversations()[group])
+	assert.Error(t, s.LeaveGroup(&Contact{Number: testContact}))
+}
+
+func TestBlocking(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	c, err := s.Contact(testContact)
+	assert.NoError(t, err)
+	_, err = s.Contact("nobody")
+	assert.Error(t, err)
+
+	assert.NoError(t, s.Block(c))
+	assert.True(t, c.IsBlocked())
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":100,"dataMessage":{"timestamp":100,"message":"spam"}}}`,
+	)
+	conv := testConversation(s, testContact)
+	assert.Empty(t, conv.Messages)
+
+	s.config.BlockedMessages = BlockedQuarantine
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":101,"dataMessage":{"timestamp":101,"message":"more spam"}}}`,
+	)
+	assert.Equal(t, "more spam", conv.Messages[101].Content)
+	assert.False(t, conv.HasNewMessage)
+
+	assert.NoError(t, s.Unblock(c))
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":102,"dataMessage":{"timestamp":102,"message":"sorry"}}}`,
+	)
+	assert.Equal(t, "sorry", conv.Messages[102].Content)
+	assert.True(t, conv.HasNewMessage)
+
+	assert.NoError(t, s.RenameContact(c, "Spammer"))
+	assert.Equal(t, c, s.Contacts().Lookup("Spammer"))
+	assert.NoError(t, s.RemoveContact(c))
+	assert.Nil(t, s.Contacts().Lookup(testContact))
+}
+
+func TestAccounts(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":100,"dataMessage":{"timestamp":100,"message":"one"}}}`,
+		`{"envelope":{"source":"+15555555551","timestamp":101,"dataMessage":{"timestamp":101,"message":"two"}}}`,
+	)
+	assert.Equal(t, 2, s.UnreadCount())
+	s.CaughtUp(s.Contacts()[testContact])
+	assert.Equal(t, 0, s.UnreadCount())
+	// the count follows messages that arrive twice, or go away
+	for i := 0; i < 2; i++ {
+		receive(t, mock,
+			`{"envelope":{"source":"+15555555551","timestamp":102,"dataMessage":{"timestamp":102,"message":"three"}}}`,
+		)
+	}
+	assert.Equal(t, 1, s.UnreadCount())
+	testConversation(s, testContact).removeMessage(102)
+	assert.Equal(t, 0, s.UnreadCount())
+
+	// conversations saved before accounts are moved to the first account that starts
+	legacy := filepath.Join(ConversationFolder(), testContact)
+	assert.NoError(t, os.MkdirAll(ConversationFolder(), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(legacy, []byte{}, 0644))
+	other := NewSiggo(signal.NewMockSignal("+15555555559", []byte{}),
+		s.config.ForAccount(Account{Number: "+15555555559"}))
+	assert.FileExists(t, filepath.Join(AccountConversationFolder("+15555555559"), testContact))
+	assert.NoFileExists(t, legacy)
+	assert.Equal(t, AccountConversationFolder("+15555555559"), other.conversationFolder())
+}
+
+func TestCalls(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":100,"callMessage":{"offerMessage":{"id":1,"type":"AUDIO_CALL"}}}}`,
+		`{"envelope":{"source":"+15555555551","timestamp":101,"callMessage":{"hangupMessage":{"id":1,"type":"NORMAL"}}}}`,
+		`{"envelope":{"source":"+15555555551","timestamp":200,"callMessage":{"offerMessage":{"id":2,"type":"VIDEO_CALL"}}}}`,
+		`{"envelope":{"source":"+15555555550","timestamp":201,"callMessage":{"hangupMessage":{"id":2,"type":"ACCEPTED"}}}}`,
+		`{"envelope":{"source":"+15555555551","timestamp":202,"callMessage":{"hangupMessage":{"id":2,"type":"NORMAL"}}}}`,
+	)
+	conv := testConversation(s, testContact)
+	assert.Equal(t, 2, len(conv.MessageOrder))
+	missed := conv.Messages[100]
+	assert.Equal(t, SystemMessage, missed.Kind)
+	assert.True(t, strings.HasPrefix(missed.Content, "📞 missed voice call from +15555555551 at "))
+	assert.True(t, strings.HasPrefix(conv.Messages[200].Content, "📞 answered video call from"))
+	assert.Equal(t, 0, len(s.calls))
+	// calls don't get read receipts
+	assert.Equal(t, 0, len(conv.CaughtUp()))
+}
+
+func TestProfile(t *testing.T) {
+	s, _ := newTestSiggo(t)
+	if err := os.MkdirAll(FindConfigFolder(), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, s.config.Save())
+	s.contacts[testUser] = &Contact{Number: testUser, Name: "self"}
+
+	// only the family name doesn't change the name
+	assert.NoError(t, s.UpdateProfile(&signal.ProfileUpdate{FamilyName: "Dallas"}))
+	assert.Equal(t, "self", s.config.UserName)
+
+	assert.NoError(t, s.UpdateProfile(&signal.ProfileUpdate{GivenName: "Leeloo", FamilyName: "Dallas"}))
+	assert.Equal(t, "Leeloo Dallas", s.config.UserName)
+	assert.Equal(t, "Leeloo Dallas", s.contacts[testUser].String())
+	cfg, err := GetConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "Leeloo Dallas", cfg.UserName)
+}
+
+func TestAttachmentStore(t *testing.T) {
+	s, _ := newTestSiggo(t)
+	src := filepath.Join(FindDataFolder(), "leeloo.png")
+	if err := os.MkdirAll(filepath.Dir(src), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(src, []byte("multipass"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conv := s.conversationFor(s.contactFor(testContact))
+	msg := &Message{Timestamp: 100, FromSelf: true}
+	msg.AddAttachments([]string{src})
+	conv.AddMessage(msg)
+	a := msg.Attachments[0]
+	assert.Equal(t, "leeloo.png", a.OriginalName)
+	assert.Equal(t, 64, len(a.Hash))
+	path, err := a.Path()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(AttachmentFolder(), a.Hash+".png"), path)
+
+	// our copy outlives the original
+	assert.NoError(t, os.Remove(src))
+	assert.FileExists(t, path)
+
+	// gc keeps what saved conversations refer to, and what is still being copied in
+	stray := filepath.Join(AttachmentFolder(), "stray")
+	assert.NoError(t, ioutil.WriteFile(stray, []byte("zorg"), 0644))
+	incoming := filepath.Join(AttachmentFolder(), incomingPrefix+"123")
+	assert.NoError(t, ioutil.WriteFile(incoming, []byte("zo"), 0644))
+	folder := AccountConversationFolder(testUser)
+	assert.NoError(t, os.MkdirAll(folder, os.ModePerm))
+	assert.NoError(t, conv.SaveAs(filepath.Join(folder, testContact)))
+	// but only if we save messages
+	_, err = CollectAttachments(s.config, time.Now())
+	assert.Error(t, err)
+	assert.FileExists(t, stray)
+	s.config.SaveMessages = true
+	removed, err := CollectAttachments(s.config, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{stray}, removed)
+	assert.FileExists(t, path)
+	assert.FileExists(t, incoming)
+
+	// unless they are too old
+	s.config.AttachmentMaxAgeDays = 30
+	removed, err = CollectAttachments(s.config, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{path}, removed)
+
+	// and not while siggo is running
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("can't run sleep: %v", err)
+	}
+	defer cmd.Process.Kill()
+	assert.NoError(t, ioutil.WriteFile(PIDPath(), []byte(strconv.Itoa(cmd.Process.Pid)), 0644))
+	_, err = CollectAttachments(s.config, time.Now())
+	assert.Error(t, err)
+}
+
+// flakySignal fails to send with `err` until it is cleared, and fails to send read receipts
+// with `receiptErr`
+type flakySignal struct {
+	*signal.MockSignal
+	err        error
+	receiptErr error
+	lock       sync.Mutex
+}
+
+func (f *flakySignal) SendReadReceipt(dest string, timestamps []int64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.receiptErr
+}
+
+func (f *flakySignal) failReceipts(err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.receiptErr = err
+}
+
+func (f *flakySignal) SendMessage(dest string, isGroup bool, msg string, opts *signal.SendOptions) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	return 12345, nil
+}
+
+func TestOutbox(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	flaky := &flakySignal{MockSignal: mock, err: &signal.Error{Kind: signal.ErrDaemonNotRunning}}
+	s = NewSiggo(flaky, s.config)
+	contact := s.contactFor(testContact)
+	conv := s.conversationFor(contact)
+
+	// temporary failures are queued and tried again
+	assert.Error(t, s.Send("hello", contact))
+	message := conv.Messages[conv.MessageOrder[0]]
+	assert.Equal(t, "hello", message.Content)
+	assert.Equal(t, Queued, message.SendState)
+	assert.FileExists(t, AccountOutboxPath(testUser))
+
+	// and survive a restart
+	restarted := NewSiggo(flaky, s.config)
+	restartedConv := restarted.conversationFor(restarted.contactFor(testContact))
+	assert.Equal(t, 1, len(restarted.outbox))
+	assert.Equal(t, "hello", restartedConv.Messages[message.Timestamp].Content)
+
+	flaky.err = nil
+	s.retryOutbox(time.Now().Add(outboxRetryMax))
+	assert.Equal(t, OutboxState(""), message.SendState)
+	assert.Equal(t, int64(12345), message.Timestamp)
+	assert.Equal(t, message, conv.Messages[12345])
+	assert.NoFileExists(t, AccountOutboxPath(testUser))
+
+	// anything else fails until we retry or cancel
+	flaky.err = &signal.Error{Kind: signal.ErrUntrustedIdentity}
+	assert.Error(t, s.Send("again", contact))
+	failed := conv.Messages[conv.MessageOrder[1]]
+	assert.Equal(t, Failed, failed.SendState)
+	assert.Contains(t, failed.String(), "not sent")
+	assert.Error(t, s.Retry(failed))
+	assert.NoError(t, s.Cancel(failed))
+	assert.Equal(t, 1, len(conv.MessageOrder))
+	assert.NoFileExists(t, AccountOutboxPath(testUser))
+}
+
+func TestEdits(t *testing.T) {
+	s, mock := newTestSiggo(t)
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555551","timestamp":100,"dataMessage":{"timestamp":100,"message":"helo"}}}`,
+		`{"envelope":{"source":"+15555555551","timestamp":101,"editMessage":{"targetSentTimestamp":100,
+			"dataMessage":{"timestamp":101,"message":"hello"}}}}`,
+		`{"envelope":{"source":"+15555555551","timestamp":102,"editMessage":{"targetSentTimestamp":101,
+			"dataMessage":{"timestamp":102,"message":"hello!"}}}}`,
+	)
+	conv := testConversation(s, testContact)
+	assert.Equal(t, 1, len(conv.MessageOrder))
+	msg := conv.Messages[100]
+	assert.Equal(t, "hello!", msg.Content)
+	assert.Equal(t, []*Edit{{"helo", 100}, {"hello", 101}}, msg.Edits)
+	assert.True(t, strings.Contains(msg.String(), "hello! (edited)"))
+
+	// we can edit our own recent messages, but nobody else's
+	assert.NotNil(t, s.Edit(conv.Contact, msg, "mine now"))
+	mine := &Message{Content: "typo", Timestamp: time.Now().UnixNano() / 1000000, FromSelf: true}
+	conv.AddMessage(mine)
+	assert.Nil(t, s.Edit(conv.Contact, mine, "fixed"))
+	assert.Equal(t, "fixed", mine.Content)
+	assert.Equal(t, 1, len(mine.Edits))
+	receive(t, mock,
+		`{"envelope":{"source":"+15555555552","timestamp":103,"editMessage":{"targetSentTimestamp":100,
+			"dataMessage":{"timestamp":103,"message":"hijacked"}}}}`,
+	)
+	assert.Equal(t, "hello!", msg.Content)
+	old := &Message{Content: "old", Timestamp: 200, FromSelf: true}
+	assert.False(t, old.CanEdit(time.Now()))
+
+	// a failed edit stays staged, with what we wrote
+	flaky := &flakySignal{MockSignal: mock, err: &signal.Error{Kind: signal.ErrNetwork}}
+	s = NewSiggo(flaky, s.config)
+	conv = s.conversationFor(s.contactFor(testContact))
+	mine = &Message{Content: "typo", Timestamp: time.Now().UnixNano() / 1000000, FromSelf: true}
+	conv.AddMessage(mine)
+	conv.StageEdit(mine)
+	assert.NotNil(t, s.Edit(conv.Contact, mine, "fixed"))
+	assert.Equal(t, mine, conv.StagedEdit())
+	assert.Equal(t, "fixed", conv.StagedMessage)
+	assert.Equal(t, "typo", mine.Content)
+	flaky.err = nil
+	assert.Nil(t, s.Edit(conv.Contact, mine, "fixed"))
+	assert.Nil(t, conv.StagedEdit())
+	assert.Equal(t, "", conv.StagedMessage)
+}
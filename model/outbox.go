@@ -0,0 +1,325 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/derricw/siggo/signal"
+	log "github.com/sirupsen/logrus"
+)
+
+// OutboxState is how far along we are with sending a message
+type OutboxState string
+
+const (
+	// Queued messages are waiting to be sent, or to be tried again after a temporary failure
+	Queued  OutboxState = "queued"
+	Sending OutboxState = "sending"
+	Sent    OutboxState = "sent"
+	// Failed messages aren't tried again unless we ask
+	Failed OutboxState = "failed"
+)
+
+// outboxRetryMin and outboxRetryMax bound how long we wait before trying a message again
+var (
+	outboxRetryMin = 2 * time.Second
+	outboxRetryMax = 5 * time.Minute
+)
+
+// OutgoingMessage is a message in the outbox. The outbox is saved to disk whenever it changes, so
+// that messages we couldn't send yet survive a restart. Read receipts go through the outbox too,
+// in which case Receipt is set instead of Message.
+type OutgoingMessage struct {
+	// ID is the timestamp of the message in the conversation until it has been sent. Then it gets
+	// the timestamp signal gave it.
+	ID      int64               `json:"id"`
+	To      PhoneNumber         `json:"to"`
+	IsGroup bool                `json:"is_group"`
+	Message *Message            `json:"message"`
+	Receipt *OutgoingReceipt    `json:"receipt,omitempty"`
+	Options *signal.SendOptions `json:"options"`
+	State   OutboxState         `json:"state"`
+	// NextAttempt is when we try a queued message again
+	NextAttempt time.Time `json:"next_attempt"`
+
+	conv    *Conversation
+	backoff signal.Backoff
+}
+
+// OutgoingReceipt is a read receipt for messages in the conversation that the outbox entry is
+// for. It goes to whoever sent the messages, even in groups.
+type OutgoingReceipt struct {
+	Sender     PhoneNumber `json:"sender"`
+	Timestamps []int64     `json:"timestamps"`
+}
+
+// setState sets the state of the outgoing message, and of its message in the conversation
+func (o *OutgoingMessage) setState(state OutboxState, err error) {
+	o.State = state
+	if o.Message == nil {
+		return
+	}
+	o.Message.SendState = state
+	if err != nil {
+		o.Message.SendError = signal.Describe(err)
+	}
+	o.conv.hasNewData = true
+}
+
+// sendStatus describes where a message we are sending is at, or "" once it has been sent
+func (m *Message) sendStatus() string {
+	switch m.SendState {
+	case Queued:
+		if m.SendError != "" {
+			return fmt.Sprintf("⏳ trying again: %s", m.SendError)
+		}
+		return "⏳"
+	case Sending:
+		return "⏳"
+	case Failed:
+		return fmt.Sprintf("⚠ not sent: %s (:retry or :cancel)", m.SendError)
+	}
+	return ""
+}
+
+// queue adds a message to the outbox
+func (s *Siggo) queue(o *OutgoingMessage) {
+	o.backoff = signal.Backoff{Min: outboxRetryMin, Max: outboxRetryMax}
+	s.outboxLock.Lock()
+	defer s.outboxLock.Unlock()
+	o.setState(Queued, nil)
+	s.outbox = append(s.outbox, o)
+	s.saveOutbox()
+}
+
+// saveOutbox writes the outbox to disk. Call it with outboxLock held.
+func (s *Siggo) saveOutbox() {
+	path := AccountOutboxPath(s.config.UserNumber)
+	if len(s.outbox) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Errorf("failed to remove outbox: %v", err)
+		}
+		return
+	}
+	b, err := json.Marshal(s.outbox)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(path, b, 0600)
+	}
+	if err != nil {
+		log.Errorf("failed to save outbox: %v", err)
+	}
+}
+
+// loadOutbox reads whatever we hadn't sent when we last quit, and puts the messages back in
+// their conversations
+func (s *Siggo) loadOutbox() {
+	b, err := ioutil.ReadFile(AccountOutboxPath(s.config.UserNumber))
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		log.Errorf("failed to read outbox: %v", err)
+		return
+	}
+	outbox := make([]*OutgoingMessage, 0)
+	if err := json.Unmarshal(b, &outbox); err != nil {
+		log.Errorf("failed to read outbox: %v", err)
+		return
+	}
+	for _, o := range outbox {
+		if o.State == Sent || (o.Message == nil && o.Receipt == nil) {
+			continue
+		}
+		contact := s.contactFor(o.To)
+		if o.IsGroup {
+			contact = s.groupFor(&signal.GroupInfo{GroupID: o.To})
+		}
+		o.conv = s.conversationFor(contact)
+		if o.Message == nil {
+			// a read receipt, which has nothing to show in the conversation
+		} else if saved, ok := o.conv.message(o.ID); ok {
+			o.Message = saved
+		} else {
+			o.conv.addMessage(o.Message)
+		}
+		o.backoff = signal.Backoff{Min: outboxRetryMin, Max: outboxRetryMax}
+		if o.State == Sending {
+			// we quit before we found out how it went
+			o.State = Queued
+		}
+		o.setState(o.State, nil)
+		s.outbox = append(s.outbox, o)
+	}
+	log.Infof("loaded %d messages from the outbox", len(s.outbox))
+}
+
+// sendOutgoing tries to send a message from the outbox. Messages that fail for a reason that
+// might go away on its own are queued to be tried again later, others are marked as failed.
+func (s *Siggo) sendOutgoing(o *OutgoingMessage) error {
+	s.outboxLock.Lock()
+	if o.State != Queued {
+		s.outboxLock.Unlock()
+		return nil
+	}
+	o.setState(Sending, nil)
+	s.saveOutbox()
+	s.outboxLock.Unlock()
+	s.NewInfo(o.conv)
+
+	var ID int64
+	var err error
+	if o.Receipt != nil {
+		log.Debugf("sending read receipt to: %s", o.Receipt.Sender)
+		err = s.signal.SendReadReceipt(o.Receipt.Sender, o.Receipt.Timestamps)
+	} else {
+		log.Debugf("sending message to: %s", o.To)
+		ID, err = s.signal.SendMessage(o.To, o.IsGroup, o.Message.Content, o.Options)
+	}
+
+	s.outboxLock.Lock()
+	defer s.NewInfo(o.conv)
+	defer s.outboxLock.Unlock()
+	if err != nil {
+		if signal.Temporary(err) {
+			o.NextAttempt = time.Now().Add(o.backoff.Next())
+			o.setState(Queued, err)
+		} else if o.Receipt != nil {
+			// there is nothing to show a failed receipt on, or to retry it from
+			log.Warnf("giving up on read receipt to %s: %v", o.Receipt.Sender, err)
+			s.removeOutgoing(o)
+		} else {
+			o.setState(Failed, err)
+		}
+		s.saveOutbox()
+		return err
+	}
+	o.setState(Sent, nil)
+	s.removeOutgoing(o)
+	s.saveOutbox()
+	if o.Receipt != nil {
+		o.conv.receiptsSent(o.Receipt.Timestamps)
+		return nil
+	}
+	// use the official timestamp from now on
+	o.conv.moveMessage(o.ID, ID)
+	o.Message.SendState = ""
+	o.Message.SendError = ""
+	// signal-cli sends with the conversation's timer, and ours starts right away
+	o.Message.ExpiresIn = o.conv.ExpiresIn
+	o.Message.startExpiry(time.Now())
+	log.Infof("successfully sent message %s with timestamp: %d", o.Message.Content, ID)
+	return nil
+}
+
+// receiptsSent records that we've sent read receipts for the messages at `timestamps`
+func (c *Conversation) receiptsSent(timestamps []int64) {
+	c.messageLock.Lock()
+	defer c.messageLock.Unlock()
+	for _, ts := range timestamps {
+		if msg, ok := c.Messages[ts]; ok {
+			msg.ReceiptSent = true
+			c.hasNewData = true
+		}
+	}
+}
+
+// removeOutgoing takes a message out of the outbox. Call it with outboxLock held.
+func (s *Siggo) removeOutgoing(o *OutgoingMessage) {
+	for i, queued := range s.outbox {
+		if queued == o {
+			s.outbox = append(s.outbox[:i], s.outbox[i+1:]...)
+			return
+		}
+	}
+}
+
+// outgoing returns the outbox entry for a message, or nil if it isn't in the outbox
+func (s *Siggo) outgoing(message *Message) *OutgoingMessage {
+	s.outboxLock.Lock()
+	defer s.outboxLock.Unlock()
+	for _, o := range s.outbox {
+		if o.Message == message {
+			return o
+		}
+	}
+	return nil
+}
+
+// retryOutbox sends every queued message that is due at `now`
+func (s *Siggo) retryOutbox(now time.Time) {
+	s.outboxLock.Lock()
+	due := make([]*OutgoingMessage, 0)
+	for _, o := range s.outbox {
+		if o.State == Queued && !o.NextAttempt.After(now) {
+			due = append(due, o)
+		}
+	}
+	s.outboxLock.Unlock()
+	for _, o := range due {
+		s.sendOutgoing(o)
+	}
+}
+
+// retryForever sends queued messages as they come due
+func (s *Siggo) retryForever() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.retryOutbox(now)
+	}
+}
+
+// wakeOutbox makes every queued message due right away, for example once signal-cli is back
+func (s *Siggo) wakeOutbox() {
+	s.outboxLock.Lock()
+	defer s.outboxLock.Unlock()
+	for _, o := range s.outbox {
+		if o.State == Queued {
+			o.NextAttempt = time.Time{}
+			o.backoff.Reset()
+		}
+	}
+}
+
+// Retry tries to send a message that we haven't managed to send yet again, right away
+func (s *Siggo) Retry(message *Message) error {
+	o := s.outgoing(message)
+	if o == nil {
+		return fmt.Errorf("message isn't waiting to be sent")
+	}
+	s.outboxLock.Lock()
+	if o.State == Sending {
+		s.outboxLock.Unlock()
+		return fmt.Errorf("message is being sent")
+	}
+	o.NextAttempt = time.Time{}
+	o.backoff.Reset()
+	o.setState(Queued, nil)
+	s.outboxLock.Unlock()
+	return s.sendOutgoing(o)
+}
+
+// Cancel gives up on sending a message, and removes it from its conversation
+func (s *Siggo) Cancel(message *Message) error {
+	o := s.outgoing(message)
+	if o == nil {
+		return fmt.Errorf("message isn't waiting to be sent")
+	}
+	s.outboxLock.Lock()
+	defer s.NewInfo(o.conv)
+	defer s.outboxLock.Unlock()
+	if o.State == Sending {
+		return fmt.Errorf("message is being sent")
+	}
+	s.removeOutgoing(o)
+	s.saveOutbox()
+	o.conv.removeMessage(o.ID)
+	log.Infof("cancelled message to: %s", o.To)
+	return nil
+}
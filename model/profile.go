@@ -0,0 +1,31 @@
+package model
+
+import (
+	"github.com/derricw/siggo/signal"
+	log "github.com/sirupsen/logrus"
+)
+
+// UpdateProfile changes our own signal profile. If the name changes, UserName follows it so that
+// we show up the same way everywhere.
+func (s *Siggo) UpdateProfile(update *signal.ProfileUpdate) error {
+	if err := s.signal.UpdateProfile(update); err != nil {
+		return err
+	}
+	if name := update.Name(); name != "" {
+		s.setUserName(name)
+	}
+	log.Infof("updated profile")
+	return nil
+}
+
+// setUserName changes our own name here and in the config file
+func (s *Siggo) setUserName(name string) {
+	s.config.UserName = name
+	if self, ok := s.contact(s.config.UserNumber); ok {
+		self.Name = name
+		s.NewInfo(s.conversationFor(self))
+	}
+	if err := SaveUserName(s.config.UserNumber, name); err != nil {
+		log.Errorf("failed to save user name: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// PIDPath returns the file where a running siggo keeps its process ID, so that commands like
+// `siggo attachments gc` can tell that it is running
+func PIDPath() string {
+	return filepath.Join(FindDataFolder(), "siggo.pid")
+}
+
+// MarkRunning records that this siggo is running, see Running
+func MarkRunning() error {
+	if err := os.MkdirAll(FindDataFolder(), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(PIDPath(), []byte(strconv.Itoa(os.Getpid())), 0644)
+}
+
+// ClearRunning removes the record that MarkRunning made, unless another siggo has replaced it
+func ClearRunning() {
+	if pid, err := readPID(); err == nil && pid == os.Getpid() {
+		os.Remove(PIDPath())
+	}
+}
+
+// Running returns the process ID of a running siggo, if there is one other than us
+func Running() (int, bool) {
+	pid, err := readPID()
+	if err != nil || pid == os.Getpid() {
+		return 0, false
+	}
+	return pid, processExists(pid)
+}
+
+func readPID() (int, error) {
+	b, err := ioutil.ReadFile(PIDPath())
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// processExists returns whether a process is running. Finding a process only fails on Windows,
+// elsewhere we have to send it signal 0 to find out.
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
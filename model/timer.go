@@ -0,0 +1,58 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timerUnits are the units we use for disappearing message timers, biggest first
+var timerUnits = []struct {
+	suffix  string
+	seconds int64
+}{
+	{"w", 7 * 24 * 60 * 60},
+	{"d", 24 * 60 * 60},
+	{"h", 60 * 60},
+	{"m", 60},
+	{"s", 1},
+}
+
+// FormatTimer formats a disappearing message timer like the phone apps do, like "1h" or "4w".
+// Timers that aren't a whole number of any unit are shown in seconds.
+func FormatTimer(seconds int64) string {
+	if seconds <= 0 {
+		return "off"
+	}
+	for _, unit := range timerUnits {
+		if seconds%unit.seconds == 0 {
+			return fmt.Sprintf("%d%s", seconds/unit.seconds, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+// ParseTimer parses a disappearing message timer like "30s", "5m", "1h", "1d" or "1w" into
+// seconds. "off" or "0" turns the timer off.
+func ParseTimer(timer string) (int64, error) {
+	timer = strings.TrimSpace(strings.ToLower(timer))
+	if timer == "off" || timer == "0" {
+		return 0, nil
+	}
+	for _, unit := range timerUnits {
+		if strings.HasSuffix(timer, unit.suffix) {
+			n, err := strconv.ParseInt(strings.TrimSuffix(timer, unit.suffix), 10, 64)
+			if err != nil || n < 0 {
+				break
+			}
+			return n * unit.seconds, nil
+		}
+	}
+	// fall back on go durations like "1h30m"
+	d, err := time.ParseDuration(timer)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid timer: %s (try 30s, 5m, 1h, 1d, 1w or off)", timer)
+	}
+	return int64(d / time.Second), nil
+}
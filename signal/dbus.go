@@ -0,0 +1,485 @@
+package signal
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DbusName is the well-known bus name that `signal-cli daemon` claims
+	DbusName = "org.asamk.Signal"
+	// DbusInterface is the interface signal-cli exports its methods and signals on
+	DbusInterface = "org.asamk.Signal"
+	// DbusPath is the object path of a single-account signal-cli daemon
+	DbusPath = dbus.ObjectPath("/org/asamk/Signal")
+)
+
+// dbusDaemonTimeout is how long we wait for a freshly started daemon to show up on the bus
+var dbusDaemonTimeout = 2 * time.Minute
+
+// DbusSignal talks to `signal-cli daemon` directly over D-Bus instead of shelling out for every
+// send. Incoming messages arrive as D-Bus signals and are converted into the same `Message`s that
+// `ProcessWire` produces, so all the usual callbacks fire. Anything the D-Bus interface can't do
+// falls back to the exec-based Signal.
+type DbusSignal struct {
+	*Signal
+	systemBus bool
+
+	lock    sync.Mutex
+	conn    *dbus.Conn
+	obj     dbus.BusObject
+	signals chan *dbus.Signal
+	closed  bool
+}
+
+// Connect connects to the session (or system) bus if we aren't connected already
+func (ds *DbusSignal) Connect() error {
+	ds.lock.Lock()
+	connected := ds.conn != nil
+	ds.lock.Unlock()
+	if connected {
+		return nil
+	}
+	conn, err := dialBus(ds.systemBus)
+	if err != nil {
+		return err
+	}
+	return ds.connectTo(conn)
+}
+
+// dialBus opens a private connection to the session (or system) bus
+func dialBus(system bool) (*dbus.Conn, error) {
+	var conn *dbus.Conn
+	var err error
+	if system {
+		conn, err = dbus.SystemBusPrivate()
+	} else {
+		conn, err = dbus.SessionBusPrivate()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.Auth(nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err = conn.Hello(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// nameHasOwner returns whether someone owns signal-cli's bus name
+func nameHasOwner(conn *dbus.Conn) bool {
+	var hasOwner bool
+	err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, DbusName).Store(&hasOwner)
+	return err == nil && hasOwner
+}
+
+// announceWhenOnBus reports us connected once the daemon we started has claimed its name on the
+// session bus, and from then on sends commands through it with `--dbus`. If we can't reach the
+// session bus we can't tell, so we report connected straight away and keep using `-u`. The
+// returned channel is closed once it has given up or the daemon has exited.
+func (s *Signal) announceWhenOnBus(exited <-chan struct{}) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := dialBus(false)
+		if err != nil {
+			log.Warnf("can't watch for signal-cli daemon on the session bus: %v", err)
+			s.setState(ConnConnected)
+			return
+		}
+		defer conn.Close()
+		for !nameHasOwner(conn) {
+			select {
+			case <-exited:
+				return
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+		s.setViaDbus(true)
+		s.setState(ConnConnected)
+	}()
+	return done
+}
+
+// connectTo subscribes to signal-cli's signals on an already established connection
+func (ds *DbusSignal) connectTo(conn *dbus.Conn) error {
+	err := conn.AddMatchSignal(
+		dbus.WithMatchInterface(DbusInterface),
+		dbus.WithMatchObjectPath(DbusPath),
+	)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	ds.lock.Lock()
+	ds.conn = conn
+	ds.obj = conn.Object(DbusName, DbusPath)
+	ds.signals = signals
+	ds.lock.Unlock()
+	// anything we can't do over dbus ourselves goes through `signal-cli --dbus`
+	ds.setViaDbus(true)
+	return nil
+}
+
+// object returns the signal-cli bus object if we are connected, otherwise nil
+func (ds *DbusSignal) object() dbus.BusObject {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	return ds.obj
+}
+
+// hasDaemon returns whether someone owns signal-cli's bus name
+func (ds *DbusSignal) hasDaemon() bool {
+	ds.lock.Lock()
+	conn := ds.conn
+	ds.lock.Unlock()
+	if conn == nil {
+		return false
+	}
+	return nameHasOwner(conn)
+}
+
+// startDaemon starts `signal-cli daemon` unless one is already on the bus, and waits for it to
+// claim its name. The returned channel is closed when a daemon that we started exits.
+func (ds *DbusSignal) startDaemon() (<-chan struct{}, error) {
+	if ds.hasDaemon() {
+		log.Infof("using signal-cli daemon already running on the bus")
+		return nil, nil
+	}
+	args := []string{"-u", ds.uname, "daemon"}
+	if ds.systemBus {
+		args = append(args, "--system")
+	}
+	cmd := exec.Command("signal-cli", args...)
+	bindToParent(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, ds.fail(err)
+	}
+	var exitErr error
+	exited := waitProcess(cmd, nil, &exitErr)
+	ds.stateLock.Lock()
+	ds.daemon = cmd
+	ds.daemonExited = exited
+	ds.stateLock.Unlock()
+
+	deadline := time.Now().Add(dbusDaemonTimeout)
+	for !ds.hasDaemon() {
+		select {
+		case <-exited:
+			return nil, fmt.Errorf("signal-cli daemon exited before it was ready")
+		case <-time.After(500 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			return exited, fmt.Errorf("timed out waiting for signal-cli daemon on dbus")
+		}
+	}
+	return exited, nil
+}
+
+// Listen connects to the bus, makes sure a daemon is running and then processes incoming signals
+// until either the bus connection or the daemon goes away.
+func (ds *DbusSignal) Listen() error {
+	if err := ds.Connect(); err != nil {
+		return err
+	}
+	exited, err := ds.startDaemon()
+	if err != nil {
+		if exited != nil {
+			// it started but never showed up on the bus, so don't leave it lying around
+			stopProcess(ds.daemon, exited)
+		}
+		return err
+	}
+	ds.lock.Lock()
+	signals := ds.signals
+	ds.lock.Unlock()
+	ds.setState(ConnConnected)
+	for {
+		select {
+		case sig, ok := <-signals:
+			if !ok {
+				ds.disconnect()
+				return fmt.Errorf("lost connection to dbus")
+			}
+			if err := ds.handleSignal(sig); err != nil {
+				log.Errorf("failed to process dbus signal %s: %v", sig.Name, err)
+			}
+		case <-exited:
+			ds.setViaDbus(false)
+			return fmt.Errorf("signal-cli daemon exited")
+		}
+	}
+}
+
+func (ds *DbusSignal) disconnect() {
+	ds.setViaDbus(false)
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	if ds.conn != nil {
+		ds.conn.Close()
+	}
+	ds.conn = nil
+	ds.obj = nil
+	ds.signals = nil
+}
+
+// ReceiveForever listens on the bus forever, reconnecting and restarting the daemon as needed.
+func (ds *DbusSignal) ReceiveForever() {
+	go ds.supervise("dbus listener", func() error {
+		log.Infof("listening for signal-cli on dbus...")
+		return ds.Listen()
+	}, ds.isClosed)
+}
+
+// handleSignal converts a D-Bus signal from signal-cli into a Message and processes it
+func (ds *DbusSignal) handleSignal(sig *dbus.Signal) error {
+	var msg *Message
+	var err error
+	switch sig.Name {
+	case DbusInterface + ".MessageReceived":
+		msg, err = messageFromDbus(sig.Body)
+	case DbusInterface + ".SyncMessageReceived":
+		msg, err = syncMessageFromDbus(sig.Body)
+	case DbusInterface + ".ReceiptReceived":
+		msg, err = receiptFromDbus(sig.Body)
+	default:
+		log.Debugf("ignoring dbus signal: %s", sig.Name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ds.ProcessMessage(msg)
+}
+
+// messageFromDbus converts a MessageReceived(x timestamp, s sender, ay groupId, s message,
+// as attachments) signal body.
+func messageFromDbus(body []interface{}) (*Message, error) {
+	var timestamp int64
+	var sender, text string
+	var groupID []byte
+	var attachments []string
+	if err := dbus.Store(body, &timestamp, &sender, &groupID, &text, &attachments); err != nil {
+		return nil, err
+	}
+	return &Message{
+		Envelope: &Envelope{
+			Source:    sender,
+			Timestamp: timestamp,
+			DataMessage: &DataMessage{
+				Timestamp:   timestamp,
+				Message:     text,
+				Attachments: attachmentsFromPaths(attachments),
+				GroupInfo:   groupInfoFromDbus(groupID),
+			},
+		},
+	}, nil
+}
+
+// syncMessageFromDbus converts a SyncMessageReceived(x timestamp, s source, s destination,
+// ay groupId, s message, as attachments) signal body.
+func syncMessageFromDbus(body []interface{}) (*Message, error) {
+	var timestamp int64
+	var source, destination, text string
+	var groupID []byte
+	var attachments []string
+	err := dbus.Store(body, &timestamp, &source, &destination, &groupID, &text, &attachments)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		Envelope: &Envelope{
+			Source:    source,
+			Timestamp: timestamp,
+			SyncMessage: &SyncMessage{
+				SentMessage: &SentMessage{
+					Timestamp:   timestamp,
+					Message:     text,
+					Destination: destination,
+					Attachments: attachmentsFromPaths(attachments),
+					GroupInfo:   groupInfoFromDbus(groupID),
+				},
+			},
+		},
+	}, nil
+}
+
+// receiptFromDbus converts a ReceiptReceived(x timestamp, s sender) signal body. signal-cli only
+// emits these for delivery receipts.
+func receiptFromDbus(body []interface{}) (*Message, error) {
+	var timestamp int64
+	var sender string
+	if err := dbus.Store(body, &timestamp, &sender); err != nil {
+		return nil, err
+	}
+	return &Message{
+		Envelope: &Envelope{
+			Source:    sender,
+			Timestamp: timestamp,
+			IsReceipt: true,
+			ReceiptMessage: &ReceiptMessage{
+				When:       time.Now().Unix() * 1000,
+				IsDelivery: true,
+				Timestamps: []int64{timestamp},
+			},
+		},
+	}, nil
+}
+
+func groupInfoFromDbus(groupID []byte) *GroupInfo {
+	if len(groupID) == 0 {
+		return nil
+	}
+	return &GroupInfo{
+		GroupID: base64.StdEncoding.EncodeToString(groupID),
+	}
+}
+
+// attachmentsFromPaths builds wire attachments from the file paths signal-cli gives us over dbus.
+// signal-cli names the files after the attachment ID.
+func attachmentsFromPaths(paths []string) []*Attachment {
+	attachments := make([]*Attachment, 0, len(paths))
+	for _, path := range paths {
+		size := 0
+		if stats, err := os.Stat(path); err == nil {
+			size = int(stats.Size())
+		}
+		ID := filepath.Base(path)
+		attachments = append(attachments, &Attachment{
+			ContentType: mime.TypeByExtension(filepath.Ext(path)),
+			Filename:    ID,
+			ID:          ID,
+			Size:        size,
+		})
+	}
+	return attachments
+}
+
+// SendDbus sends a message to a number using signal-cli's sendMessage method
+func (ds *DbusSignal) SendDbus(dest, msg string, attachments ...string) (int64, error) {
+	obj := ds.object()
+	if obj == nil {
+		return ds.Signal.SendDbus(dest, msg, attachments...)
+	}
+	if !strings.HasPrefix(dest, "+") {
+		dest = fmt.Sprintf("+%s", dest)
+	}
+	if attachments == nil {
+		attachments = []string{}
+	}
+	var ID int64
+	err := obj.Call(DbusInterface+".sendMessage", 0, msg, attachments, dest).Store(&ID)
+	if err != nil {
+		return 0, ds.fail(err)
+	}
+	return ID, nil
+}
+
+// SendMessage sends a message over dbus. signal-cli's dbus interface can't send replies, mentions
+// or edits, so those go through `signal-cli --dbus` instead.
+func (ds *DbusSignal) SendMessage(dest string, isGroup bool, msg string, opts *SendOptions) (int64, error) {
+	if opts == nil {
+		opts = &SendOptions{}
+	}
+	if opts.QuoteTimestamp != 0 || len(opts.Mentions) > 0 || opts.EditTimestamp != 0 {
+		return ds.Signal.SendMessage(dest, isGroup, msg, opts)
+	}
+	if isGroup {
+		return ds.SendGroupDbus(dest, msg, opts.Attachments...)
+	}
+	return ds.SendDbus(dest, msg, opts.Attachments...)
+}
+
+// Send is the same as SendDbus
+func (ds *DbusSignal) Send(dest, msg string) (int64, error) {
+	return ds.SendDbus(dest, msg)
+}
+
+// SendGroupDbus sends a message to a group using signal-cli's sendGroupMessage method
+func (ds *DbusSignal) SendGroupDbus(groupID, msg string, attachments ...string) (int64, error) {
+	obj := ds.object()
+	if obj == nil {
+		return ds.Signal.SendGroupDbus(groupID, msg, attachments...)
+	}
+	rawID, err := base64.StdEncoding.DecodeString(groupID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid group ID %s: %v", groupID, err)
+	}
+	if attachments == nil {
+		attachments = []string{}
+	}
+	var ID int64
+	err = obj.Call(DbusInterface+".sendGroupMessage", 0, msg, attachments, rawID).Store(&ID)
+	if err != nil {
+		return 0, ds.fail(err)
+	}
+	return ID, nil
+}
+
+// RequestGroupInfo gets the IDs and names of our groups from the daemon. If we aren't connected
+// to one, we ask signal-cli directly.
+func (ds *DbusSignal) RequestGroupInfo() ([]SignalGroupInfo, error) {
+	obj := ds.object()
+	if obj == nil || !ds.hasDaemon() {
+		return ds.Signal.RequestGroupInfo()
+	}
+	var groupIDs [][]byte
+	if err := obj.Call(DbusInterface+".getGroupIds", 0).Store(&groupIDs); err != nil {
+		return nil, err
+	}
+	info := make([]SignalGroupInfo, 0, len(groupIDs))
+	for _, rawID := range groupIDs {
+		var name string
+		if err := obj.Call(DbusInterface+".getGroupName", 0, rawID).Store(&name); err != nil {
+			return nil, err
+		}
+		info = append(info, SignalGroupInfo{
+			ID:       base64.StdEncoding.EncodeToString(rawID),
+			Name:     name,
+			IsMember: true,
+		})
+	}
+	return info, nil
+}
+
+func (ds *DbusSignal) isClosed() bool {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	return ds.closed
+}
+
+// Close disconnects from the bus and stops the daemon if we started it
+func (ds *DbusSignal) Close() {
+	ds.lock.Lock()
+	ds.closed = true
+	ds.lock.Unlock()
+	ds.disconnect()
+	ds.Signal.Close()
+}
+
+// NewDbusSignal returns a new D-Bus backed signal instance for the specified user. If
+// `systemBus` is set we look for (and start) the daemon on the system bus instead of the session
+// bus.
+func NewDbusSignal(uname string, systemBus bool) *DbusSignal {
+	return &DbusSignal{
+		Signal:    NewSignal(uname),
+		systemBus: systemBus,
+	}
+}
@@ -0,0 +1,152 @@
+package signal
+
+import (
+	"bufio"
+	"encoding/base64"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSignalCLI stands in for `signal-cli daemon` on the bus
+type fakeSignalCLI struct {
+	// lock guards sent, which dbus handlers append to from their own goroutines
+	lock sync.Mutex
+	sent []string
+}
+
+func (f *fakeSignalCLI) send(msg string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.sent = append(f.sent, msg)
+}
+
+// messages returns what has been sent so far
+func (f *fakeSignalCLI) messages() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string{}, f.sent...)
+}
+
+func (f *fakeSignalCLI) SendMessage(msg string, attachments []string, recipient string) (int64, *dbus.Error) {
+	f.send(recipient + ": " + msg)
+	return 1234, nil
+}
+
+func (f *fakeSignalCLI) SendGroupMessage(msg string, attachments []string, groupID []byte) (int64, *dbus.Error) {
+	f.send(string(groupID) + ": " + msg)
+	return 5678, nil
+}
+
+func (f *fakeSignalCLI) GetGroupIds() ([][]byte, *dbus.Error) {
+	return [][]byte{[]byte("group")}, nil
+}
+
+func (f *fakeSignalCLI) GetGroupName(groupID []byte) (string, *dbus.Error) {
+	return "The Group", nil
+}
+
+// startTestBus starts a private dbus-daemon and returns its address
+func startTestBus(t *testing.T) string {
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not available")
+	}
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Skipf("failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() { cmd.Process.Kill(); cmd.Wait() })
+	address, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read dbus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func dialTestBus(t *testing.T, address string) *dbus.Conn {
+	conn, err := dbus.Dial(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Auth(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Hello(); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestDbusSignal(t *testing.T) {
+	address := startTestBus(t)
+
+	server := dialTestBus(t, address)
+	defer server.Close()
+	fake := &fakeSignalCLI{}
+	err := server.ExportWithMap(fake, map[string]string{
+		"SendMessage":      "sendMessage",
+		"SendGroupMessage": "sendGroupMessage",
+		"GetGroupIds":      "getGroupIds",
+		"GetGroupName":     "getGroupName",
+	}, DbusPath, DbusInterface)
+	assert.Nil(t, err)
+	_, err = server.RequestName(DbusName, dbus.NameFlagDoNotQueue)
+	assert.Nil(t, err)
+
+	ds := NewDbusSignal("+15555555555", false)
+	assert.Nil(t, ds.connectTo(dialTestBus(t, address)))
+	defer ds.Close()
+	assert.True(t, ds.hasDaemon())
+
+	ID, err := ds.SendDbus("15555555556", "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1234), ID)
+	groupID := base64.StdEncoding.EncodeToString([]byte("group"))
+	ID, err = ds.SendGroupDbus(groupID, "hi all")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5678), ID)
+	assert.Equal(t, []string{"+15555555556: hello", "group: hi all"}, fake.messages())
+
+	info, err := ds.RequestGroupInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, []SignalGroupInfo{{ID: groupID, Name: "The Group", IsMember: true}}, info)
+
+	received := make(chan *Message, 1)
+	ds.OnReceived(func(msg *Message) error {
+		received <- msg
+		return nil
+	})
+	go ds.Listen()
+	err = server.Emit(DbusPath, DbusInterface+".MessageReceived",
+		int64(42), "+15555555556", []byte("group"), "incoming", []string{})
+	assert.Nil(t, err)
+	select {
+	case msg := <-received:
+		assert.Equal(t, "+15555555556", msg.Envelope.Source)
+		assert.Equal(t, "incoming", msg.Envelope.DataMessage.Message)
+		assert.Equal(t, groupID, msg.Envelope.DataMessage.GroupInfo.GroupID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for MessageReceived")
+	}
+}
+
+func TestDbusDisconnect(t *testing.T) {
+	address := startTestBus(t)
+
+	ds := NewDbusSignal("+15555555555", false)
+	assert.Nil(t, ds.connectTo(dialTestBus(t, address)))
+	defer ds.Close()
+	assert.Equal(t, []string{"--dbus", "send"}, ds.cliArgs("send"))
+	// once the bus is gone, commands go straight to signal-cli again
+	ds.disconnect()
+	assert.Equal(t, []string{"-u", "+15555555555", "send"}, ds.cliArgs("send"))
+}
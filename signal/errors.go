@@ -0,0 +1,158 @@
+package signal
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// These are the kinds of failures from signal-cli that we know how to explain. Use errors.Is to
+// check for them.
+var (
+	ErrUntrustedIdentity = errors.New("untrusted identity")
+	ErrUnregistered      = errors.New("not registered with signal")
+	ErrRateLimited       = errors.New("rate limited")
+	ErrNetwork           = errors.New("network unavailable")
+	ErrNotGroupMember    = errors.New("not a member of the group")
+	ErrDaemonNotRunning  = errors.New("signal-cli daemon not running")
+	// these come up while registering
+	ErrCaptchaRequired    = errors.New("captcha required")
+	ErrRegistrationLock   = errors.New("registration lock")
+	ErrVerificationFailed = errors.New("verification failed")
+)
+
+// errorPatterns are the (lowercase) things signal-cli says for each kind of failure
+var errorPatterns = []struct {
+	kind     error
+	patterns []string
+}{
+	// signal-cli mentions verification when it wants a captcha, and when the number has a PIN, so
+	// those go first
+	{ErrCaptchaRequired, []string{"captcha"}},
+	{ErrRegistrationLock, []string{"locked with a pin", "registration lock"}},
+	{ErrVerificationFailed, []string{"verification failed", "verification code"}},
+	{ErrUntrustedIdentity, []string{"untrusted identity", "untrustedidentity"}},
+	{ErrUnregistered, []string{"unregistered user", "unregistereduser"}},
+	{ErrRateLimited, []string{"rate limit", "ratelimit", "status code: 413", "status code: 429"}},
+	{ErrNotGroupMember, []string{"not a member", "notagroupmember", "group not found"}},
+	{ErrDaemonNotRunning, []string{"serviceunknown", "was not provided by any .service", "jsonrpc is not running", "no daemon"}},
+	{ErrNetwork, []string{"unknownhost", "unable to resolve host", "network is unreachable", "sockettimeout", "timed out", "connection reset", "no route to host"}},
+}
+
+// fixes are what the user can do about each kind of failure
+var fixes = map[error]string{
+	ErrUntrustedIdentity:  "their safety number changed. Check it with them, then trust their new key with `S` or `siggo trust`",
+	ErrUnregistered:       "they aren't on signal, or the number is wrong",
+	ErrRateLimited:        "signal wants us to slow down. Wait a while and try again",
+	ErrNetwork:            "check your internet connection and try again",
+	ErrNotGroupMember:     "you aren't in this group anymore. Ask a member to add you back, or leave it",
+	ErrDaemonNotRunning:   "signal-cli is restarting. Try again in a moment",
+	ErrCaptchaRequired:    "solve one at " + CaptchaURL + " and pass the signalcaptcha:// link it gives you with --captcha",
+	ErrRegistrationLock:   "this number has a registration lock, pass its PIN with --pin",
+	ErrVerificationFailed: "signal didn't accept the verification code, check it or register again",
+}
+
+// Error is a failure from signal-cli, with whatever it had to say about it
+type Error struct {
+	// Kind is one of the Err* values above, or nil if we don't know what went wrong
+	Kind error
+	// Detail is the most useful line of what signal-cli said
+	Detail string
+	// Err is the original error
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Kind == nil {
+		return fmt.Sprintf("signal-cli: %s", e.Detail)
+	}
+	if e.Detail == "" {
+		return e.Kind.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Kind, e.Detail)
+}
+
+// Is lets errors.Is match an Error to its kind
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Fix returns what the user can do about the error, if we know
+func (e *Error) Fix() string {
+	return fixes[e.Kind]
+}
+
+// Classify turns an error from running signal-cli (or talking to it over jsonRpc or dbus) into an
+// *Error, using what signal-cli wrote to stderr if we have it
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var classified *Error
+	if errors.As(err, &classified) {
+		return err
+	}
+	text := err.Error()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		text = string(exitErr.Stderr)
+	}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		text = rpcErr.Message
+	}
+	return &Error{
+		Kind:   kindOf(text),
+		Detail: lastLine(text),
+		Err:    err,
+	}
+}
+
+// kindOf finds the kind of failure signal-cli is describing
+func kindOf(text string) error {
+	lower := strings.ToLower(text)
+	for _, p := range errorPatterns {
+		for _, pattern := range p.patterns {
+			if strings.Contains(lower, pattern) {
+				return p.kind
+			}
+		}
+	}
+	return nil
+}
+
+// lastLine returns the last line of `text` that isn't blank. signal-cli tends to log warnings
+// before it gets around to the actual error.
+func lastLine(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// Describe returns an error message along with what to do about it, if we know
+func Describe(err error) string {
+	var classified *Error
+	if errors.As(err, &classified) {
+		if fix := classified.Fix(); fix != "" {
+			return fmt.Sprintf("%v (%s)", err, fix)
+		}
+	}
+	return err.Error()
+}
+
+// Temporary returns true if an error is likely to go away if we try again later, like signal-cli
+// restarting or the network being down
+func Temporary(err error) bool {
+	return errors.Is(err, ErrDaemonNotRunning) || errors.Is(err, ErrNetwork) || errors.Is(err, ErrRateLimited)
+}
+
+// fail classifies an error, tells anyone listening about it and returns it
+func (s *Signal) fail(err error) error {
+	err = Classify(err)
+	s.publishError(err)
+	return err
+}
@@ -0,0 +1,87 @@
+package signal
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	stderr := "WARN  SignalAccount - some warning\n" +
+		"Failed to send message: Untrusted Identity for \"+15555555551\"\n"
+	err := Classify(&exec.ExitError{Stderr: []byte(stderr)})
+	assert.True(t, errors.Is(err, ErrUntrustedIdentity))
+	assert.Equal(t, `untrusted identity: Failed to send message: Untrusted Identity for "+15555555551"`, err.Error())
+	assert.Contains(t, Describe(err), "safety number")
+	var exitErr *exec.ExitError
+	assert.True(t, errors.As(err, &exitErr))
+
+	err = Classify(&RPCError{Code: -1, Message: "Rate limit exceeded: 413"})
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.Equal(t, err, Classify(err))
+
+	err = Classify(fmt.Errorf("java.net.UnknownHostException: chat.signal.org"))
+	assert.True(t, errors.Is(err, ErrNetwork))
+	assert.True(t, Temporary(err))
+
+	err = Classify(&exec.ExitError{Stderr: []byte("something new\n")})
+	assert.False(t, errors.Is(err, ErrNetwork))
+	assert.False(t, Temporary(err))
+	assert.Equal(t, "signal-cli: something new", err.Error())
+	assert.Equal(t, "signal-cli: something new", Describe(err))
+	assert.Nil(t, Classify(nil))
+
+	// registering
+	err = Classify(&exec.ExitError{Stderr: []byte("Captcha invalid or required for verification (null)\n")})
+	assert.True(t, errors.Is(err, ErrCaptchaRequired))
+	assert.Contains(t, Describe(err), CaptchaURL)
+	err = Classify(&exec.ExitError{Stderr: []byte("Verification failed! This number is locked with a pin. Hours remaining: 168")})
+	assert.True(t, errors.Is(err, ErrRegistrationLock))
+	assert.Contains(t, Describe(err), "--pin")
+}
+
+// fakeSignalCLIPath puts a signal-cli on PATH that runs `script` instead
+func fakeSignalCLIPath(t *testing.T, script string) func() {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake signal-cli is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "siggo-test")
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "signal-cli"), []byte("#!/bin/sh\n"+script), 0755)
+	assert.Nil(t, err)
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	return func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestExecErrors(t *testing.T) {
+	defer fakeSignalCLIPath(t, "echo 'Rate limit exceeded: 413' >&2\nexit 1\n")()
+
+	_, err := Exec("-v")
+	var exitErr *exec.ExitError
+	assert.True(t, errors.As(err, &exitErr))
+	assert.Equal(t, "Rate limit exceeded: 413\n", string(exitErr.Stderr))
+
+	_, err = NewSignal(testNumber).Version()
+	assert.True(t, errors.Is(err, ErrRateLimited))
+
+	s := NewSignal(testNumber)
+	var published error
+	s.OnError(func(err error) { published = err })
+	err = s.Receive()
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.Equal(t, err, published)
+
+	err = s.Link("laptop")
+	assert.True(t, errors.Is(err, ErrRateLimited))
+}
@@ -0,0 +1,642 @@
+package signal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// rpcTimeout is how long we wait for signal-cli to answer a single request
+var rpcTimeout = 60 * time.Second
+
+// rpcMaxLine is the longest line we are willing to read from signal-cli. Envelopes with lots of
+// attachments or long messages can be well over bufio's default of 64KB.
+const rpcMaxLine = 4 * 1024 * 1024
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+	ID      string      `json:"id"`
+}
+
+// rpcResponse is anything that comes back from signal-cli. Responses to our requests have an ID,
+// notifications (like incoming messages) have a Method and Params instead.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      string          `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Result  json.RawMessage `json:"result"`
+	Error   *RPCError       `json:"error"`
+}
+
+// RPCError is an error returned by signal-cli in response to a JSON-RPC request
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("signal-cli jsonRpc error %d: %s", e.Code, e.Message)
+}
+
+// rpcClient multiplexes JSON-RPC requests and notifications over a single reader/writer pair.
+type rpcClient struct {
+	w      io.Writer
+	notify func(method string, params json.RawMessage)
+
+	writeLock sync.Mutex
+	lock      sync.Mutex
+	nextID    int64
+	pending   map[string]chan *rpcResponse
+	closed    bool
+}
+
+func newRPCClient(w io.Writer, notify func(string, json.RawMessage)) *rpcClient {
+	return &rpcClient{
+		w:       w,
+		notify:  notify,
+		pending: make(map[string]chan *rpcResponse),
+	}
+}
+
+// Call sends a request and waits for the matching response. If `result` is not nil the response
+// result is unmarshalled into it.
+func (c *rpcClient) Call(method string, params interface{}, result interface{}) error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return fmt.Errorf("signal-cli jsonRpc is not running")
+	}
+	c.nextID++
+	ID := strconv.FormatInt(c.nextID, 10)
+	respChan := make(chan *rpcResponse, 1)
+	c.pending[ID] = respChan
+	c.lock.Unlock()
+
+	b, err := json.Marshal(&rpcRequest{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+		ID:      ID,
+	})
+	if err != nil {
+		c.forget(ID)
+		return err
+	}
+	log.Debugf("jsonRpc request: %s", b)
+	c.writeLock.Lock()
+	_, err = c.w.Write(append(b, '\n'))
+	c.writeLock.Unlock()
+	if err != nil {
+		c.forget(ID)
+		return err
+	}
+
+	select {
+	case resp, ok := <-respChan:
+		if !ok {
+			return fmt.Errorf("signal-cli jsonRpc exited before answering %s", method)
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 {
+			return json.Unmarshal(resp.Result, result)
+		}
+		return nil
+	case <-time.After(rpcTimeout):
+		c.forget(ID)
+		return fmt.Errorf("timed out waiting for signal-cli to answer %s", method)
+	}
+}
+
+func (c *rpcClient) forget(ID string) {
+	c.lock.Lock()
+	delete(c.pending, ID)
+	c.lock.Unlock()
+}
+
+// Serve reads responses and notifications from `r` until it is closed. Any outstanding requests
+// are failed when it returns.
+func (c *rpcClient) Serve(r io.Reader) error {
+	defer c.close()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), rpcMaxLine)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		log.Debugf("jsonRpc wire (length %d): %s", len(line), line)
+		resp := &rpcResponse{}
+		if err := json.Unmarshal(line, resp); err != nil {
+			log.Errorf("failed to unmarshal jsonRpc line: %s - %s", line, err)
+			continue
+		}
+		if resp.ID == "" {
+			if resp.Method != "" && c.notify != nil {
+				c.notify(resp.Method, resp.Params)
+			}
+			continue
+		}
+		c.lock.Lock()
+		respChan, ok := c.pending[resp.ID]
+		delete(c.pending, resp.ID)
+		c.lock.Unlock()
+		if !ok {
+			log.Warnf("jsonRpc response for unknown request: %s", resp.ID)
+			continue
+		}
+		respChan <- resp
+	}
+	return scanner.Err()
+}
+
+func (c *rpcClient) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closed = true
+	for ID, respChan := range c.pending {
+		close(respChan)
+		delete(c.pending, ID)
+	}
+}
+
+// rpcSendResult is what signal-cli returns for a `send`
+type rpcSendResult struct {
+	Timestamp int64 `json:"timestamp"`
+}
+
+// JSONRPCSignal keeps a single `signal-cli jsonRpc` process running and does all sending and
+// receiving through it, so we only pay for the JVM once. Whenever that process isn't running we
+// fall back to the exec-based Signal.
+type JSONRPCSignal struct {
+	*Signal
+	lock   sync.Mutex
+	client *rpcClient
+	proc   *exec.Cmd
+	stdin  io.WriteCloser
+	served chan struct{}
+	// exited is closed once signal-cli has exited and been reaped, with exitErr set
+	exited  <-chan struct{}
+	exitErr error
+	closed  bool
+}
+
+// rpc returns the client if signal-cli jsonRpc is currently running, otherwise nil
+func (js *JSONRPCSignal) rpc() *rpcClient {
+	js.lock.Lock()
+	defer js.lock.Unlock()
+	return js.client
+}
+
+// Call invokes a JSON-RPC method on the running signal-cli process
+func (js *JSONRPCSignal) Call(method string, params interface{}, result interface{}) error {
+	client := js.rpc()
+	if client == nil {
+		return &Error{Kind: ErrDaemonNotRunning, Detail: "signal-cli jsonRpc is not running"}
+	}
+	if err := client.Call(method, params, result); err != nil {
+		return js.fail(err)
+	}
+	return nil
+}
+
+func (js *JSONRPCSignal) onNotification(method string, params json.RawMessage) {
+	if method != "receive" {
+		log.Debugf("ignoring jsonRpc notification: %s", method)
+		return
+	}
+	if err := js.ProcessWire(params); err != nil {
+		log.Errorf("failed to process incoming message: %v", err)
+	}
+}
+
+// Start starts signal-cli in jsonRpc mode and returns once it is running. Use Wait to block until
+// it exits.
+func (js *JSONRPCSignal) Start() error {
+	cmd := exec.Command("signal-cli", "-u", js.uname, "jsonRpc")
+	bindToParent(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return js.fail(err)
+	}
+	client := newRPCClient(stdin, js.onNotification)
+	served := make(chan struct{})
+	js.lock.Lock()
+	js.proc = cmd
+	js.stdin = stdin
+	js.client = client
+	js.served = served
+	js.exited = waitProcess(cmd, served, &js.exitErr)
+	js.lock.Unlock()
+
+	go func() {
+		defer close(served)
+		if err := client.Serve(stdout); err != nil {
+			log.Errorf("error reading from signal-cli jsonRpc: %v", err)
+		}
+		js.lock.Lock()
+		if js.client == client {
+			js.client = nil
+		}
+		js.lock.Unlock()
+	}()
+	return nil
+}
+
+// Wait blocks until the running signal-cli process exits
+func (js *JSONRPCSignal) Wait() error {
+	js.lock.Lock()
+	exited := js.exited
+	js.lock.Unlock()
+	if exited == nil {
+		return nil
+	}
+	<-exited
+	js.lock.Lock()
+	defer js.lock.Unlock()
+	return js.exitErr
+}
+
+// ReceiveForever keeps signal-cli jsonRpc running, restarting it if it exits. Incoming messages
+// are processed as they arrive.
+func (js *JSONRPCSignal) ReceiveForever() {
+	go js.supervise("signal-cli jsonRpc", func() error {
+		log.Infof("starting signal-cli jsonRpc...")
+		if err := js.Start(); err != nil {
+			return err
+		}
+		js.setState(ConnConnected)
+		if err := js.Wait(); err != nil {
+			return err
+		}
+		return fmt.Errorf("signal-cli jsonRpc exited")
+	}, js.isClosed)
+}
+
+func (js *JSONRPCSignal) isClosed() bool {
+	js.lock.Lock()
+	defer js.lock.Unlock()
+	return js.closed
+}
+
+// Receive is a no-op while jsonRpc is running, because messages are pushed to us as they arrive.
+// Otherwise we receive the exec way.
+func (js *JSONRPCSignal) Receive() error {
+	if js.rpc() != nil {
+		return nil
+	}
+	return js.Signal.Receive()
+}
+
+// SendMessage sends a message to a number or a group through jsonRpc if it is running
+func (js *JSONRPCSignal) SendMessage(dest string, isGroup bool, msg string, opts *SendOptions) (int64, error) {
+	if js.rpc() == nil {
+		return js.Signal.SendMessage(dest, isGroup, msg, opts)
+	}
+	params := recipientParams(dest, isGroup)
+	params["message"] = msg
+	if opts != nil {
+		if len(opts.Attachments) > 0 {
+			params["attachments"] = opts.Attachments
+		}
+		if opts.QuoteTimestamp != 0 {
+			params["quoteTimestamp"] = opts.QuoteTimestamp
+			params["quoteAuthor"] = opts.QuoteAuthor
+		}
+		if opts.EditTimestamp != 0 {
+			params["editTimestamp"] = opts.EditTimestamp
+		}
+		if len(opts.Mentions) > 0 {
+			params["mention"] = mentionArgs(opts.Mentions)
+		}
+	}
+	result := &rpcSendResult{}
+	if err := js.Call("send", params, result); err != nil {
+		return 0, err
+	}
+	return result.Timestamp, nil
+}
+
+// Send transmits a message to the specified number
+func (js *JSONRPCSignal) Send(dest, msg string) (int64, error) {
+	return js.SendMessage(dest, false, msg, nil)
+}
+
+// SendDbus sends a message to a number through jsonRpc if it is running. The name is kept so that
+// we satisfy the same interface as Signal.
+func (js *JSONRPCSignal) SendDbus(dest, msg string, attachments ...string) (int64, error) {
+	return js.SendMessage(dest, false, msg, &SendOptions{Attachments: attachments})
+}
+
+// SendGroupDbus does the same thing as SendDbus but to a group
+func (js *JSONRPCSignal) SendGroupDbus(groupID, msg string, attachments ...string) (int64, error) {
+	return js.SendMessage(groupID, true, msg, &SendOptions{Attachments: attachments})
+}
+
+// recipientParams returns the jsonRpc params that address either a number or a group
+func recipientParams(dest string, isGroup bool) map[string]interface{} {
+	if isGroup {
+		return map[string]interface{}{"groupId": dest}
+	}
+	if !strings.HasPrefix(dest, "+") {
+		dest = fmt.Sprintf("+%s", dest)
+	}
+	return map[string]interface{}{"recipient": []string{dest}}
+}
+
+// SendRemoteDelete deletes one of our messages for everyone through jsonRpc if it is running
+func (js *JSONRPCSignal) SendRemoteDelete(dest string, isGroup bool, targetTimestamp int64) error {
+	if js.rpc() == nil {
+		return js.Signal.SendRemoteDelete(dest, isGroup, targetTimestamp)
+	}
+	params := recipientParams(dest, isGroup)
+	params["targetTimestamp"] = targetTimestamp
+	return js.Call("remoteDelete", params, nil)
+}
+
+// SetExpiration sets the disappearing message timer through jsonRpc if it is running
+func (js *JSONRPCSignal) SetExpiration(dest string, isGroup bool, seconds int64) error {
+	if js.rpc() == nil {
+		return js.Signal.SetExpiration(dest, isGroup, seconds)
+	}
+	if isGroup {
+		return js.Call("updateGroup", map[string]interface{}{
+			"groupId":    dest,
+			"expiration": seconds,
+		}, nil)
+	}
+	if !strings.HasPrefix(dest, "+") {
+		dest = fmt.Sprintf("+%s", dest)
+	}
+	return js.Call("updateContact", map[string]interface{}{
+		"recipient":  dest,
+		"expiration": seconds,
+	}, nil)
+}
+
+// UpdateContact sets the name we have for a contact through jsonRpc if it is running
+func (js *JSONRPCSignal) UpdateContact(number string, name string) error {
+	if js.rpc() == nil {
+		return js.Signal.UpdateContact(number, name)
+	}
+	if !strings.HasPrefix(number, "+") {
+		number = fmt.Sprintf("+%s", number)
+	}
+	return js.Call("updateContact", map[string]interface{}{
+		"recipient": number,
+		"name":      name,
+	}, nil)
+}
+
+// RemoveContact forgets a contact through jsonRpc if it is running
+func (js *JSONRPCSignal) RemoveContact(number string) error {
+	if js.rpc() == nil {
+		return js.Signal.RemoveContact(number)
+	}
+	if !strings.HasPrefix(number, "+") {
+		number = fmt.Sprintf("+%s", number)
+	}
+	return js.Call("removeContact", map[string]interface{}{"recipient": number}, nil)
+}
+
+// blockParams are the params for block and unblock, which take lists of groups
+func blockParams(dest string, isGroup bool) map[string]interface{} {
+	if isGroup {
+		return map[string]interface{}{"groupId": []string{dest}}
+	}
+	return recipientParams(dest, false)
+}
+
+// Block blocks a number or group through jsonRpc if it is running
+func (js *JSONRPCSignal) Block(dest string, isGroup bool) error {
+	if js.rpc() == nil {
+		return js.Signal.Block(dest, isGroup)
+	}
+	return js.Call("block", blockParams(dest, isGroup), nil)
+}
+
+// Unblock unblocks a number or group through jsonRpc if it is running
+func (js *JSONRPCSignal) Unblock(dest string, isGroup bool) error {
+	if js.rpc() == nil {
+		return js.Signal.Unblock(dest, isGroup)
+	}
+	return js.Call("unblock", blockParams(dest, isGroup), nil)
+}
+
+// ListIdentities lists identity keys through jsonRpc if it is running
+func (js *JSONRPCSignal) ListIdentities(number string) ([]*Identity, error) {
+	if js.rpc() == nil {
+		return js.Signal.ListIdentities(number)
+	}
+	var params map[string]interface{}
+	if number != "" {
+		params = map[string]interface{}{"number": recipientArgs(number, false)[0]}
+	}
+	identities := []*Identity{}
+	if err := js.Call("listIdentities", params, &identities); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// Trust trusts a number's identity key through jsonRpc if it is running
+func (js *JSONRPCSignal) Trust(number string, safetyNumber string) error {
+	if js.rpc() == nil {
+		return js.Signal.Trust(number, safetyNumber)
+	}
+	params := map[string]interface{}{"recipient": recipientArgs(number, false)[0]}
+	if safetyNumber == "" {
+		params["trustAllKnownKeys"] = true
+	} else {
+		params["verifiedSafetyNumber"] = safetyNumber
+	}
+	return js.Call("trust", params, nil)
+}
+
+// SendReadReceipt sends a read receipt through jsonRpc if it is running
+func (js *JSONRPCSignal) SendReadReceipt(dest string, timestamps []int64) error {
+	if js.rpc() == nil {
+		return js.Signal.SendReadReceipt(dest, timestamps)
+	}
+	if !strings.HasPrefix(dest, "+") {
+		dest = fmt.Sprintf("+%s", dest)
+	}
+	return js.Call("sendReceipt", map[string]interface{}{
+		"recipient":       dest,
+		"targetTimestamp": timestamps,
+		"type":            "read",
+	}, nil)
+}
+
+// UpdateProfile changes our own profile through jsonRpc if it is running
+func (js *JSONRPCSignal) UpdateProfile(update *ProfileUpdate) error {
+	if js.rpc() == nil {
+		return js.Signal.UpdateProfile(update)
+	}
+	params := make(map[string]interface{})
+	strs := map[string]string{
+		"givenName":  update.GivenName,
+		"familyName": update.FamilyName,
+		"about":      update.About,
+		"aboutEmoji": update.AboutEmoji,
+		"avatar":     update.Avatar,
+	}
+	for key, value := range strs {
+		if value != "" {
+			params[key] = value
+		}
+	}
+	if update.RemoveAvatar {
+		params["removeAvatar"] = true
+	}
+	return js.Call("updateProfile", params, nil)
+}
+
+// rpcGroupResult is what signal-cli returns for an `updateGroup`
+type rpcGroupResult struct {
+	GroupID   string `json:"groupId"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// UpdateGroup changes or creates a group through jsonRpc if it is running
+func (js *JSONRPCSignal) UpdateGroup(groupID string, update *GroupUpdate) (string, error) {
+	if js.rpc() == nil {
+		return js.Signal.UpdateGroup(groupID, update)
+	}
+	params := make(map[string]interface{})
+	if groupID != "" {
+		params["groupId"] = groupID
+	}
+	strs := map[string]string{
+		"name":        update.Name,
+		"description": update.Description,
+		"avatar":      update.Avatar,
+	}
+	for key, value := range strs {
+		if value != "" {
+			params[key] = value
+		}
+	}
+	lists := map[string][]string{
+		"member":       update.AddMembers,
+		"removeMember": update.RemoveMembers,
+		"admin":        update.AddAdmins,
+		"removeAdmin":  update.RemoveAdmins,
+	}
+	for key, numbers := range lists {
+		if len(numbers) > 0 {
+			params[key] = numbers
+		}
+	}
+	result := &rpcGroupResult{}
+	if err := js.Call("updateGroup", params, result); err != nil {
+		return "", err
+	}
+	if result.GroupID == "" {
+		return groupID, nil
+	}
+	return result.GroupID, nil
+}
+
+// QuitGroup leaves a group through jsonRpc if it is running
+func (js *JSONRPCSignal) QuitGroup(groupID string) error {
+	if js.rpc() == nil {
+		return js.Signal.QuitGroup(groupID)
+	}
+	return js.Call("quitGroup", map[string]interface{}{"groupId": groupID}, nil)
+}
+
+// SendTyping sends a typing indicator through jsonRpc if it is running
+func (js *JSONRPCSignal) SendTyping(dest string, isGroup bool, stop bool) error {
+	if js.rpc() == nil {
+		return js.Signal.SendTyping(dest, isGroup, stop)
+	}
+	params := recipientParams(dest, isGroup)
+	params["stop"] = stop
+	return js.Call("sendTyping", params, nil)
+}
+
+// SendReaction reacts to a message with an emoji, or removes the reaction
+func (js *JSONRPCSignal) SendReaction(dest string, isGroup bool, emoji, targetAuthor string, targetTimestamp int64, remove bool) error {
+	if js.rpc() == nil {
+		return js.Signal.SendReaction(dest, isGroup, emoji, targetAuthor, targetTimestamp, remove)
+	}
+	params := recipientParams(dest, isGroup)
+	params["emoji"] = emoji
+	params["targetAuthor"] = targetAuthor
+	params["targetTimestamp"] = targetTimestamp
+	params["remove"] = remove
+	return js.Call("sendReaction", params, nil)
+}
+
+// ListContacts asks signal-cli for our contacts through jsonRpc if it is running
+func (js *JSONRPCSignal) ListContacts() ([]*SignalContact, error) {
+	if js.rpc() == nil {
+		return js.Signal.ListContacts()
+	}
+	contacts := []*SignalContact{}
+	if err := js.Call("listContacts", nil, &contacts); err != nil {
+		return nil, err
+	}
+	for _, c := range contacts {
+		c.Blocked = c.Blocked || c.IsBlocked
+	}
+	return contacts, nil
+}
+
+// RequestGroupInfo requests info for all groups from the Signal network
+func (js *JSONRPCSignal) RequestGroupInfo() ([]SignalGroupInfo, error) {
+	if js.rpc() == nil {
+		return js.Signal.RequestGroupInfo()
+	}
+	groupInfo := []SignalGroupInfo{}
+	if err := js.Call("listGroups", nil, &groupInfo); err != nil {
+		return nil, err
+	}
+	return groupInfo, nil
+}
+
+// Close stops the jsonRpc process and anything the embedded Signal started
+func (js *JSONRPCSignal) Close() {
+	js.lock.Lock()
+	js.closed = true
+	cmd := js.proc
+	stdin := js.stdin
+	exited := js.exited
+	js.lock.Unlock()
+	if stdin != nil {
+		stdin.Close()
+	}
+	if cmd != nil {
+		log.Debug("stopping signal-cli jsonRpc...")
+		stopProcess(cmd, exited)
+	}
+	js.Signal.Close()
+}
+
+// NewJSONRPCSignal returns a new JSON-RPC backed signal instance for the specified user. Nothing
+// is started until ReceiveForever (or Start) is called.
+func NewJSONRPCSignal(uname string) *JSONRPCSignal {
+	js := &JSONRPCSignal{
+		Signal: NewSignal(uname),
+	}
+	js.lister = js
+	return js
+}
@@ -0,0 +1,62 @@
+package signal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeJSONRPC answers every request with `result` after first pushing a receive notification,
+// like signal-cli does when a message arrives while we are sending.
+func fakeJSONRPC(t *testing.T, requests io.Reader, responses io.Writer, result string) {
+	scanner := bufio.NewScanner(requests)
+	for scanner.Scan() {
+		req := &rpcRequest{}
+		if err := json.Unmarshal(scanner.Bytes(), req); err != nil {
+			t.Errorf("bad request: %s", err)
+			return
+		}
+		fmt.Fprintf(responses, `{"jsonrpc":"2.0","method":"receive","params":{"envelope":{"source":"+15555555555"}}}`+"\n")
+		fmt.Fprintf(responses, `{"jsonrpc":"2.0","result":%s,"id":"%s"}`+"\n", result, req.ID)
+	}
+}
+
+func TestRPCClientCall(t *testing.T) {
+	reqReader, reqWriter := io.Pipe()
+	respReader, respWriter := io.Pipe()
+	go fakeJSONRPC(t, reqReader, respWriter, `{"timestamp":1234}`)
+
+	notifications := make(chan string, 1)
+	client := newRPCClient(reqWriter, func(method string, params json.RawMessage) {
+		notifications <- method
+	})
+	go client.Serve(respReader)
+
+	result := &rpcSendResult{}
+	err := client.Call("send", map[string]interface{}{"message": "hi"}, result)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1234), result.Timestamp)
+	assert.Equal(t, "receive", <-notifications)
+}
+
+func TestRPCClientClosed(t *testing.T) {
+	reqReader, reqWriter := io.Pipe()
+	respReader, respWriter := io.Pipe()
+	go io.Copy(ioutil.Discard, reqReader)
+
+	client := newRPCClient(reqWriter, nil)
+	done := make(chan error)
+	go func() {
+		done <- client.Call("listGroups", nil, nil)
+	}()
+	go client.Serve(respReader)
+	respWriter.Close()
+	assert.NotNil(t, <-done)
+	// further calls fail right away
+	assert.NotNil(t, client.Call("listGroups", nil, nil))
+}
@@ -1,6 +1,8 @@
 package signal
 
-import ()
+import (
+	"fmt"
+)
 
 type Message struct {
 	Envelope *Envelope `json:"envelope"`
@@ -14,35 +16,159 @@ type Envelope struct {
 	CallMessage    *CallMessage    `json:"callMessage"`
 	ReceiptMessage *ReceiptMessage `json:"receiptMessage"`
 	DataMessage    *DataMessage    `json:"dataMessage"`
+	EditMessage    *EditMessage    `json:"editMessage"`
+	TypingMessage  *TypingMessage  `json:"typingMessage"`
 	SourceDevice   int             `json:"sourceDevice"`
 }
 
+// Typing actions
+const (
+	TypingStarted = "STARTED"
+	TypingStopped = "STOPPED"
+)
+
+// TypingMessage tells us that someone started or stopped typing. GroupID is set if they are
+// typing in a group.
+type TypingMessage struct {
+	Action    string `json:"action"`
+	Timestamp int64  `json:"timestamp"`
+	GroupID   string `json:"groupId"`
+}
+
 type SyncMessage struct {
-	SentMessage  *SentMessage `json:"sentMessage"`
-	Type         interface{}  `json:"type"`
-	ReadMessages interface{}  `json:"readMessages"`
+	SentMessage  *SentMessage   `json:"sentMessage"`
+	Type         interface{}    `json:"type"`
+	ReadMessages []*ReadMessage `json:"readMessages"`
+}
+
+// ReadMessage tells us that we read a message on another device. The message is identified by
+// its sender and timestamp.
+type ReadMessage struct {
+	Sender     string `json:"sender"`
+	SenderUUID string `json:"senderUuid"`
+	Timestamp  int64  `json:"timestamp"`
 }
 
 type SentMessage struct {
-	Timestamp        int64         `json:"timestamp"`
-	Message          string        `json:"message"`
-	ExpiresInSeconds int64         `json:"expiresInSeconds"`
-	Attachments      []*Attachment `json:"attachments"`
-	GroupInfo        *GroupInfo    `json:"groupInfo"`
-	Destination      string        `json:"destination"`
-	Mentions         interface{}   `json:"mentions"`
-	ViewOnce         bool          `json:"viewOnce"`
+	Timestamp          int64         `json:"timestamp"`
+	Message            string        `json:"message"`
+	ExpiresInSeconds   int64         `json:"expiresInSeconds"`
+	IsExpirationUpdate bool          `json:"isExpirationUpdate"`
+	Attachments        []*Attachment `json:"attachments"`
+	GroupInfo          *GroupInfo    `json:"groupInfo"`
+	Destination        string        `json:"destination"`
+	Mentions           []*Mention    `json:"mentions"`
+	ViewOnce           bool          `json:"viewOnce"`
+	Reaction           *Reaction     `json:"reaction"`
+	Quote              *Quote        `json:"quote"`
+	RemoteDelete       *RemoteDelete `json:"remoteDelete"`
+	Sticker            *Sticker      `json:"sticker"`
+	EditMessage        *EditMessage  `json:"editMessage"`
 }
 
 type DataMessage struct {
-	Timestamp        int64         `json:"timestamp"`
-	Message          string        `json:"message"`
-	ExpiresInSeconds int64         `json:"expiresInSeconds"`
-	Attachments      []*Attachment `json:"attachments"`
-	GroupInfo        *GroupInfo    `json:"groupInfo"`
+	Timestamp          int64         `json:"timestamp"`
+	Message            string        `json:"message"`
+	ExpiresInSeconds   int64         `json:"expiresInSeconds"`
+	IsExpirationUpdate bool          `json:"isExpirationUpdate"`
+	Mentions           []*Mention    `json:"mentions"`
+	Sticker            *Sticker      `json:"sticker"`
+	ViewOnce           bool          `json:"viewOnce"`
+	Attachments        []*Attachment `json:"attachments"`
+	GroupInfo          *GroupInfo    `json:"groupInfo"`
+	Reaction           *Reaction     `json:"reaction"`
+	Quote              *Quote        `json:"quote"`
+	RemoteDelete       *RemoteDelete `json:"remoteDelete"`
+}
+
+// Mention is a group member mentioned in a message. Start and Length are the range of the
+// message text (in UTF-16 code units) that the mention replaces, usually a single U+FFFC.
+type Mention struct {
+	Name   string `json:"name"`
+	Number string `json:"number"`
+	UUID   string `json:"uuid"`
+	Start  int    `json:"start"`
+	Length int    `json:"length"`
+}
+
+// String formats the mention the way signal-cli's `--mention` wants it
+func (m *Mention) String() string {
+	return fmt.Sprintf("%d:%d:%s", m.Start, m.Length, m.Number)
+}
+
+// Sticker is a sticker from a sticker pack. Older versions of signal-cli include the sticker
+// file as an attachment, newer ones keep it with the pack.
+type Sticker struct {
+	PackID     string      `json:"packId"`
+	PackKey    string      `json:"packKey"`
+	StickerID  int         `json:"stickerId"`
+	Emoji      string      `json:"emoji"`
+	Attachment *Attachment `json:"attachment"`
+}
+
+// RemoteDelete retracts an earlier message ("delete for everyone")
+type RemoteDelete struct {
+	// Timestamp is the timestamp of the deleted message
+	Timestamp int64 `json:"timestamp"`
+}
+
+// EditMessage replaces the text of an earlier message. DataMessage is the new version.
+type EditMessage struct {
+	TargetSentTimestamp int64        `json:"targetSentTimestamp"`
+	DataMessage         *DataMessage `json:"dataMessage"`
+}
+
+// Quote is the message that a reply is quoting
+type Quote struct {
+	ID           int64  `json:"id"`
+	Author       string `json:"author"`
+	AuthorNumber string `json:"authorNumber"`
+	AuthorUUID   string `json:"authorUuid"`
+	Text         string `json:"text"`
+}
+
+// Reaction is an emoji reaction to an earlier message
+type Reaction struct {
+	Emoji               string `json:"emoji"`
+	TargetAuthor        string `json:"targetAuthor"`
+	TargetAuthorNumber  string `json:"targetAuthorNumber"`
+	TargetAuthorUUID    string `json:"targetAuthorUuid"`
+	TargetSentTimestamp int64  `json:"targetSentTimestamp"`
+	IsRemove            bool   `json:"isRemove"`
+}
+
+// Call types, from an offer
+const (
+	AudioCall = "AUDIO_CALL"
+	VideoCall = "VIDEO_CALL"
+)
+
+// Hangup types
+const (
+	HangupNormal     = "NORMAL"
+	HangupAccepted   = "ACCEPTED"
+	HangupDeclined   = "DECLINED"
+	HangupBusy       = "BUSY"
+	HangupPermission = "NEED_PERMISSION"
+)
+
+// CallMessage is part of setting up or ending a voice or video call. Only one of the messages is
+// usually set. Calls are identified by their ID.
+type CallMessage struct {
+	OfferMessage      *CallEvent    `json:"offerMessage"`
+	AnswerMessage     *CallEvent    `json:"answerMessage"`
+	BusyMessage       *CallEvent    `json:"busyMessage"`
+	HangupMessage     *CallEvent    `json:"hangupMessage"`
+	IceUpdateMessages []interface{} `json:"iceUpdateMessages"`
 }
 
-type CallMessage interface{}
+// CallEvent is an offer, answer, busy or hangup message. Type is only set for offers (see
+// AudioCall) and hangups (see HangupNormal).
+type CallEvent struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type"`
+	DeviceID int    `json:"deviceId"`
+}
 
 type ReceiptMessage struct {
 	When       int64   `json:"when"`
@@ -1,10 +1,10 @@
 package signal
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -27,11 +27,25 @@ var fakeSendReceipt *Message = &Message{
 	},
 }
 
+// ReplayOptions control how the mock replays messages saved with `--record`. Messages without an
+// arrival time, like the output of `signal-cli receive --json`, are always replayed right away.
+type ReplayOptions struct {
+	// Speed scales the time between messages: 1 is real speed, 2 is twice as fast. 0 replays
+	// everything at once.
+	Speed float64
+	// Step holds each message back until Step is called
+	Step bool
+}
+
 // MockSignal implements siggo's SignalAPI interface without actually calling signal-cli for anything
 type MockSignal struct {
 	*Signal
 	exampleData []byte
 	userNumber  string
+	replay      ReplayOptions
+	steps       chan struct{}
+	// lock guards exampleData and replay, since we replay from our own goroutine
+	lock sync.Mutex
 }
 
 // Version just returns the last known compatible version of signal-cli
@@ -41,22 +55,30 @@ func (ms *MockSignal) Version() (string, error) {
 
 // Send just sends a fake message, by putting it on the "wire"
 func (ms *MockSignal) Send(dest, msg string) (int64, error) {
-	timestamp := time.Now().Unix()
-	fakeWire := fakeSendReceipt
-	fakeWire.Envelope.Timestamp = timestamp
-	fakeWire.Envelope.SyncMessage.SentMessage.Timestamp = timestamp
-	fakeWire.Envelope.SyncMessage.SentMessage.Message = msg
-	fakeWire.Envelope.SyncMessage.SentMessage.Destination = dest
+	timestamp := time.Now().UnixNano() / 1000000
+	fakeWire := *fakeSendReceipt.Envelope
+	sent := *fakeWire.SyncMessage.SentMessage
+	sent.Timestamp = timestamp
+	sent.Message = msg
+	sent.Destination = dest
+	fakeWire.Timestamp = timestamp
+	fakeWire.SyncMessage = &SyncMessage{SentMessage: &sent}
 
 	log.Printf("%v", fakeWire)
-	b, err := json.Marshal(fakeWire)
+	b, err := json.Marshal(&Message{Envelope: &fakeWire})
 	if err != nil {
 		return 0, fmt.Errorf("failed to marshal send receipt: %v", err)
 	}
-	ms.exampleData = append(ms.exampleData, b...)
+	ms.lock.Lock()
+	ms.exampleData = append(ms.exampleData, append(b, '\n')...)
+	ms.lock.Unlock()
 	return timestamp, nil
 }
 
+func (ms *MockSignal) SendMessage(dest string, isGroup bool, msg string, opts *SendOptions) (int64, error) {
+	return ms.Send(dest, msg)
+}
+
 func (ms *MockSignal) SendDbus(dest, msg string, attachments ...string) (int64, error) {
 	return ms.Send(dest, msg)
 }
@@ -65,37 +87,171 @@ func (ms *MockSignal) SendGroupDbus(groupID, msg string, attachments ...string)
 	return ms.Send(groupID, msg)
 }
 
+func (ms *MockSignal) SendReaction(dest string, isGroup bool, emoji, targetAuthor string, targetTimestamp int64, remove bool) error {
+	log.Printf("fake reaction %s to %d", emoji, targetTimestamp)
+	return nil
+}
+
+func (ms *MockSignal) SendRemoteDelete(dest string, isGroup bool, targetTimestamp int64) error {
+	log.Printf("fake remote delete of %d", targetTimestamp)
+	return nil
+}
+
+func (ms *MockSignal) SetExpiration(dest string, isGroup bool, seconds int64) error {
+	return nil
+}
+
+func (ms *MockSignal) SendReadReceipt(dest string, timestamps []int64) error {
+	log.Printf("fake read receipt to %s for %v", dest, timestamps)
+	return nil
+}
+
+func (ms *MockSignal) UpdateGroup(groupID string, update *GroupUpdate) (string, error) {
+	if groupID == "" {
+		groupID = fmt.Sprintf("mock-group-%d", time.Now().UnixNano())
+	}
+	log.Printf("fake group update of %s: %+v", groupID, update)
+	return groupID, nil
+}
+
+func (ms *MockSignal) QuitGroup(groupID string) error {
+	return nil
+}
+
+func (ms *MockSignal) UpdateProfile(update *ProfileUpdate) error {
+	log.Printf("fake profile update: %+v", update)
+	return nil
+}
+
+func (ms *MockSignal) UpdateContact(number string, name string) error {
+	return nil
+}
+
+func (ms *MockSignal) RemoveContact(number string) error {
+	return nil
+}
+
+func (ms *MockSignal) Block(dest string, isGroup bool) error {
+	return nil
+}
+
+func (ms *MockSignal) Unblock(dest string, isGroup bool) error {
+	return nil
+}
+
+func (ms *MockSignal) ListIdentities(number string) ([]*Identity, error) {
+	return []*Identity{}, nil
+}
+
+func (ms *MockSignal) Trust(number string, safetyNumber string) error {
+	return nil
+}
+
+func (ms *MockSignal) SendTyping(dest string, isGroup bool, stop bool) error {
+	return nil
+}
+
+// Receive processes all of the example data at once
 func (ms *MockSignal) Receive() error {
-	r := bytes.NewReader(ms.exampleData)
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		wire := scanner.Bytes()
+	for wire := ms.next(); wire != nil; wire = ms.next() {
+		_, wire = parseRecorded(wire)
 		err := ms.ProcessWire(wire)
 		if err != nil {
 			return err
 		}
 	}
-	ms.exampleData = []byte{}
 	return nil
 }
 
+// next takes the next line of example data, or returns nil if there isn't any
+func (ms *MockSignal) next() []byte {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	for len(ms.exampleData) > 0 {
+		line := ms.exampleData
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line, ms.exampleData = line[:i], ms.exampleData[i+1:]
+		} else {
+			ms.exampleData = []byte{}
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			return line
+		}
+	}
+	return nil
+}
+
+// Replay sets how ReceiveForever replays recorded messages
+func (ms *MockSignal) Replay(opts ReplayOptions) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	ms.replay = opts
+}
+
+// Step lets the next message through when replaying step by step
+func (ms *MockSignal) Step() {
+	select {
+	case ms.steps <- struct{}{}:
+	default:
+		// nothing is waiting, so there's nothing left to replay
+	}
+}
+
+// wait holds a recorded message back until it is due. `last` and `at` are when the previous
+// message and this one arrived.
+func (ms *MockSignal) wait(last, at int64) {
+	ms.lock.Lock()
+	opts := ms.replay
+	ms.lock.Unlock()
+	if opts.Step {
+		<-ms.steps
+		return
+	}
+	if opts.Speed <= 0 || last == 0 || at <= last {
+		return
+	}
+	gap := time.Duration(float64(time.Duration(at-last)*time.Millisecond) / opts.Speed)
+	time.Sleep(gap)
+}
+
+// ReceiveForever replays the example data, then keeps receiving whatever we send
 func (ms *MockSignal) ReceiveForever() {
+	ms.setState(ConnConnected)
 	go func() {
-		ms.Receive()
-		time.Sleep(time.Second * 1)
+		var last int64
+		for !ms.isStopped() {
+			line := ms.next()
+			if line == nil {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			at, wire := parseRecorded(line)
+			if at != 0 {
+				ms.wait(last, at)
+				last = at
+			}
+			if err := ms.ProcessWire(wire); err != nil {
+				log.Errorf("failed to process mock message: %v", err)
+			}
+		}
 	}()
 }
 
+func (ms *MockSignal) ListContacts() ([]*SignalContact, error) {
+	return []*SignalContact{}, nil
+}
+
 func (ms *MockSignal) RequestGroupInfo() ([]SignalGroupInfo, error) {
 	return []SignalGroupInfo{}, nil
 }
 
-func (ms *MockSignal) Close() {}
-
 func NewMockSignal(userNumber string, exampleData []byte) *MockSignal {
-	return &MockSignal{
+	ms := &MockSignal{
 		Signal:      NewSignal(userNumber),
 		exampleData: exampleData,
 		userNumber:  userNumber,
+		steps:       make(chan struct{}),
 	}
+	ms.lister = ms
+	return ms
 }
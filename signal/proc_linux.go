@@ -0,0 +1,17 @@
+//go:build linux
+// +build linux
+
+package signal
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// bindToParent makes sure signal-cli dies with us, even if we are killed with SIGKILL and don't
+// get a chance to stop it ourselves
+func bindToParent(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Pdeathsig: syscall.SIGKILL,
+	}
+}
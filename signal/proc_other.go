@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package signal
+
+import (
+	"os/exec"
+)
+
+// bindToParent does nothing outside of Linux, which is the only place Pdeathsig exists. If we are
+// killed with SIGKILL, signal-cli will be left running and will have to be killed manually.
+func bindToParent(cmd *exec.Cmd) {}
@@ -0,0 +1,64 @@
+package signal
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// RecordedWire is a wire message as the recorder saves it, one per line. At is when it arrived
+// (ms since epoch). Wire that isn't JSON is saved as a string.
+type RecordedWire struct {
+	At   int64           `json:"at"`
+	Wire json.RawMessage `json:"wire"`
+}
+
+// Recorder writes every wire message we receive, with the time it arrived, so that the mock
+// backend can replay them later
+type Recorder struct {
+	w    io.Writer
+	lock sync.Mutex
+}
+
+// Record writes a wire message
+func (r *Recorder) Record(wire []byte) error {
+	recorded := &RecordedWire{
+		At:   time.Now().UnixNano() / 1000000,
+		Wire: json.RawMessage(wire),
+	}
+	if !json.Valid(wire) {
+		quoted, err := json.Marshal(string(wire))
+		if err != nil {
+			return err
+		}
+		recorded.Wire = quoted
+	}
+	b, err := json.Marshal(recorded)
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_, err = r.w.Write(append(b, '\n'))
+	return err
+}
+
+// NewRecorder returns a recorder that writes to `w`
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// parseRecorded returns the wire message in a line of mock data, and when it arrived. Lines
+// that weren't written by a Recorder are plain wire messages, so they have no arrival time.
+func parseRecorded(line []byte) (int64, []byte) {
+	recorded := &RecordedWire{}
+	if err := json.Unmarshal(line, recorded); err != nil || len(recorded.Wire) == 0 {
+		return 0, line
+	}
+	var str string
+	if err := json.Unmarshal(recorded.Wire, &str); err == nil {
+		return recorded.At, []byte(str)
+	}
+	return recorded.At, recorded.Wire
+}
@@ -0,0 +1,81 @@
+package signal
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordedMock records `messages` arriving `gap` apart, and returns a mock that replays them
+func recordedMock(t *testing.T, gap time.Duration, messages ...string) *MockSignal {
+	var b bytes.Buffer
+	at := time.Now().UnixNano() / 1000000
+	for _, m := range messages {
+		wire := fmt.Sprintf(`{"envelope":{"source":"+15555555551","timestamp":%d,"dataMessage":{"message":"%s"}}}`, at, m)
+		b.WriteString(fmt.Sprintf(`{"at":%d,"wire":%s}`+"\n", at, wire))
+		at += int64(gap / time.Millisecond)
+	}
+	return NewMockSignal(testNumber, b.Bytes())
+}
+
+// collect returns the messages that `ms` receives, as they arrive
+func collect(ms *MockSignal) func() []string {
+	var lock sync.Mutex
+	received := make([]string, 0)
+	ms.OnReceived(func(msg *Message) error {
+		lock.Lock()
+		defer lock.Unlock()
+		received = append(received, msg.Envelope.DataMessage.Message)
+		return nil
+	})
+	return func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string{}, received...)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	var b bytes.Buffer
+	r := NewRecorder(&b)
+	assert.NoError(t, r.Record([]byte(`{"envelope":{}}`)))
+	assert.NoError(t, r.Record([]byte(`not json`)))
+	lines := bytes.Split(bytes.TrimSpace(b.Bytes()), []byte("\n"))
+	assert.Equal(t, 2, len(lines))
+	at, wire := parseRecorded(lines[0])
+	assert.NotZero(t, at)
+	assert.Equal(t, `{"envelope":{}}`, string(wire))
+	_, wire = parseRecorded(lines[1])
+	assert.Equal(t, "not json", string(wire))
+	// plain signal-cli output replays as is
+	at, wire = parseRecorded([]byte(`{"envelope":{"source":"+15555555551"}}`))
+	assert.Zero(t, at)
+	assert.Equal(t, `{"envelope":{"source":"+15555555551"}}`, string(wire))
+}
+
+func TestReplay(t *testing.T) {
+	ms := recordedMock(t, time.Second, "one", "two", "three")
+	received := collect(ms)
+	ms.Replay(ReplayOptions{Speed: 10})
+	ms.ReceiveForever()
+	defer ms.Close()
+	// ten times as fast, so 100ms apart
+	assert.Eventually(t, func() bool { return len(received()) == 3 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"one", "two", "three"}, received())
+
+	ms = recordedMock(t, time.Hour, "one", "two")
+	received = collect(ms)
+	ms.Replay(ReplayOptions{Step: true})
+	ms.ReceiveForever()
+	defer ms.Close()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, []string{}, received())
+	ms.Step()
+	assert.Eventually(t, func() bool { return len(received()) == 1 }, time.Second, 10*time.Millisecond)
+	ms.Step()
+	assert.Eventually(t, func() bool { return len(received()) == 2 }, time.Second, 10*time.Millisecond)
+}
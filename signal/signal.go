@@ -6,15 +6,16 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
 
 	qr "github.com/mdp/qrterminal/v3"
 	log "github.com/sirupsen/logrus"
@@ -26,8 +27,12 @@ var SignalDataDir string = fmt.Sprintf("%s/data", SignalDir)
 var SignalAttachmentsDir string = fmt.Sprintf("%s/attachments", SignalDir)
 var SignalAvatarsDir string = fmt.Sprintf("%s/avatars", SignalDir)
 
-// GetSignalFolder returns the user's signal-cli local storage
+// GetSignalFolder returns the user's signal-cli local storage. Like signal-cli, we respect
+// $XDG_DATA_HOME if it is set.
 func GetSignalFolder() (string, error) {
+	if XDGData := os.Getenv("XDG_DATA_HOME"); XDGData != "" {
+		return filepath.Join(XDGData, "signal-cli"), nil
+	}
 	usr, err := user.Current()
 	if err != nil {
 		return "", err
@@ -35,6 +40,15 @@ func GetSignalFolder() (string, error) {
 	return filepath.Join(usr.HomeDir, SignalDir), nil
 }
 
+// GetSignalDataFolder returns the folder where signal-cli keeps its account data
+func GetSignalDataFolder() (string, error) {
+	signalFolder, err := GetSignalFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(signalFolder, "data"), nil
+}
+
 // GetSignalAvatarsFolder returns the user's signal-cli avatars folder
 func GetSignalAvatarsFolder() (string, error) {
 	signalFolder, err := GetSignalFolder()
@@ -44,18 +58,31 @@ func GetSignalAvatarsFolder() (string, error) {
 	return filepath.Join(signalFolder, "avatars"), nil
 }
 
+// GetSignalStickerFolder returns the folder where signal-cli keeps sticker packs for an account
+func GetSignalStickerFolder(uname string) (string, error) {
+	dataFolder, err := GetSignalDataFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataFolder, uname+".d", "stickers"), nil
+}
+
 // SignalContact is the data signal-cli saves for each contact
 // in SignalDataDir/<phonenumber>.
 // This structure no longer exists as of signal-cli >= 0.8.2
 type SignalContact struct {
 	Name                  string `json:"name"`
 	Number                string `json:"number"`
+	UUID                  string `json:"uuid"`
 	Color                 string `json:"color"`
 	MessageExpirationTime int    `json:"messageExpirationTime"`
 	ProfileKey            string `json:"profileKey"`
 	Blocked               bool   `json:"blocked"`
 	InboxPosition         *int   `json:"inboxPosition"`
 	Archived              bool   `json:"archived"`
+
+	// IsBlocked is what `signal-cli listContacts` calls Blocked
+	IsBlocked bool `json:"isBlocked"`
 }
 
 // SignalRecipient is the format used in the `recipients-store` file.
@@ -79,6 +106,7 @@ func (r *SignalRecipient) AsContact() *SignalContact {
 	return &SignalContact{
 		Name:                  r.Contact.Name,
 		Number:                r.Number,
+		UUID:                  r.UUID,
 		Color:                 r.Contact.Color,
 		MessageExpirationTime: r.Contact.MessageExpirationTime,
 		ProfileKey:            r.ProfileKey,
@@ -101,9 +129,11 @@ func (r *SignalRecipientStore) AsContacts() []*SignalContact {
 }
 
 // SignalGroup is the data that signal-cli saves for each group
-// in SignalDataDir/<phonenumber>
+// in SignalDataDir/<phonenumber>. Name is only known when the group list comes from
+// `signal-cli listGroups`.
 type SignalGroup struct {
 	GroupID          string `json:"groupId"`
+	Name             string `json:"name,omitempty"`
 	MasterKey        string `json:"masterKey"`
 	Blocked          bool   `json:"blocked"`
 	PermissionDenied bool   `json:"permissionDenied"`
@@ -150,17 +180,19 @@ type SentCallback func(*Message) error
 type ReceiptCallback func(*Message) error
 type ReceivedCallback func(*Message) error
 type ErrorCallback func(error)
+type TypingCallback func(*Message) error
+type ReadSyncCallback func(*Message) error
+type CallCallback func(*Message) error
+type EditCallback func(*Message) error
 
-// Exec invokes signal-cli with the supplied args and returns the bytes that writes to stdout
+// Exec invokes signal-cli with the supplied args and returns the bytes that writes to stdout. If
+// it fails, the *exec.ExitError carries what it wrote to stderr, for Classify.
 func Exec(args ...string) ([]byte, error) {
-	var out bytes.Buffer
-	cmd := exec.Command("signal-cli", args...)
-	cmd.Stdout = &out
-	err := cmd.Run()
+	out, err := exec.Command("signal-cli", args...).Output()
 	if err != nil {
 		return []byte{}, err
 	}
-	return out.Bytes(), nil
+	return out, nil
 }
 
 // Signal represents a signal-cli session for a given user. It can be run in daemon mode by calling
@@ -172,7 +204,29 @@ type Signal struct {
 	receiptCallbacks  []ReceiptCallback
 	receivedCallbacks []ReceivedCallback
 	errorCallbacks    []ErrorCallback
+	typingCallbacks   []TypingCallback
+	readSyncCallbacks []ReadSyncCallback
+	callCallbacks     []CallCallback
+	editCallbacks     []EditCallback
+	recorder          *Recorder
+	stateCallbacks    []StateChangeCallback
 	daemon            *exec.Cmd
+	// daemonExited is closed once the daemon has exited and been reaped
+	daemonExited <-chan struct{}
+
+	// stateLock guards state, stopped and viaDbus, which the supervisor, senders and Close touch
+	// from different goroutines
+	stateLock sync.Mutex
+	state     ConnState
+	stopped   bool
+	// viaDbus is set when a daemon is on the bus that we should send commands through
+	viaDbus bool
+
+	// lister is the backend that embeds us, which storage asks for anything that isn't on disk
+	lister ContactLister
+	// storage is picked the first time we need it, because asking for the version starts a JVM
+	storageOnce sync.Once
+	storage     Storage
 }
 
 // OnMessage registers a callback to be executed upon any incoming message of any kind (that we
@@ -203,6 +257,39 @@ func (s *Signal) OnError(callback ErrorCallback) {
 	s.errorCallbacks = append(s.errorCallbacks, callback)
 }
 
+func (s *Signal) OnTyping(callback TypingCallback) {
+	s.typingCallbacks = append(s.typingCallbacks, callback)
+}
+
+func (s *Signal) OnReadSync(callback ReadSyncCallback) {
+	s.readSyncCallbacks = append(s.readSyncCallbacks, callback)
+}
+
+// OnCall registers a callback to be executed whenever someone calls us, answers or hangs up.
+func (s *Signal) OnCall(callback CallCallback) {
+	s.callCallbacks = append(s.callCallbacks, callback)
+}
+
+// OnEdit registers a callback to be executed whenever someone edits a message they sent us.
+func (s *Signal) OnEdit(callback EditCallback) {
+	s.editCallbacks = append(s.editCallbacks, callback)
+}
+
+// Record makes us write every wire message we receive to `recorder`
+func (s *Signal) Record(recorder *Recorder) {
+	s.recorder = recorder
+}
+
+// record writes a wire message to the recorder, if we have one
+func (s *Signal) record(wire []byte) {
+	if s.recorder == nil {
+		return
+	}
+	if err := s.recorder.Record(wire); err != nil {
+		log.Errorf("failed to record wire message: %v", err)
+	}
+}
+
 func (s *Signal) publishError(err error) {
 	for _, cb := range s.errorCallbacks {
 		cb(err)
@@ -213,7 +300,7 @@ func (s *Signal) publishError(err error) {
 func (s *Signal) Version() (string, error) {
 	b, err := Exec("-v")
 	if err != nil {
-		return "", err
+		return "", Classify(err)
 	}
 	versionStr := fmt.Sprintf("%s", b)
 	versionNum := strings.Split(versionStr, " ")
@@ -229,7 +316,7 @@ func (s *Signal) Version() (string, error) {
 func (s *Signal) Receive() error {
 	b, err := Exec("-u", s.uname, "receive", "--json")
 	if err != nil {
-		return err
+		return s.fail(err)
 	}
 	r := bytes.NewReader(b)
 	scanner := bufio.NewScanner(r)
@@ -246,31 +333,25 @@ func (s *Signal) Receive() error {
 // ReceiveForever receives contiuously. WARNING: this will continuously start and stop the JVM and
 // is not recommended unless you want to simulate the Electon app's recource useage.
 func (s *Signal) ReceiveForever() {
-	go func() {
-		for {
-			log.Infof("starting dbus daemon...")
-			err := s.Daemon()
-			if err != nil {
-				log.Error(fmt.Errorf("daemon failed to start... restarting in 5 seconds..."))
-				time.Sleep(5 * time.Second)
-			}
-		}
-	}()
+	go s.supervise("signal-cli daemon", func() error {
+		log.Infof("starting dbus daemon...")
+		return s.Daemon()
+	}, s.isStopped)
+}
+
+func (s *Signal) isStopped() bool {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	return s.stopped
 }
 
 // Daemon starts the dbus daemon and receives forever.
 func (s *Signal) Daemon() error {
 	cmd := exec.Command("signal-cli", "-o", "json", "-u", s.uname, "daemon")
-
-	//  This is the only way to ensure that the signal-cli daemon is killed when we get
-	//  SIGKILL, but it isn't available on MacOS, so we leave it commented out for now.
-	//  This means that SIGKILL will leave an orphaned signal-cli daemon running that will have to be
-	//  killed manually. I have tried unsuccessfully to find a cross-platform solution for this.
-	//  Other signals, like SIGTERM and SIGINT should be handled correctly.
-
-	//cmd.SysProcAttr = &syscall.SysProcAttr{
-	//Pdeathsig: syscall.SIGKILL,
-	//}
+	// on Linux the daemon dies with us, even if we get SIGKILL. Elsewhere, SIGKILL will leave an
+	// orphaned daemon running that will have to be killed manually. Other signals, like SIGTERM
+	// and SIGINT, are handled by Close.
+	bindToParent(cmd)
 
 	outReader, err := cmd.StdoutPipe()
 	if err != nil {
@@ -278,22 +359,137 @@ func (s *Signal) Daemon() error {
 	}
 	err = cmd.Start()
 	if err != nil {
-		s.publishError(err)
-		return err
+		return s.fail(err)
 	}
+	exited := make(chan struct{})
+	s.stateLock.Lock()
 	s.daemon = cmd
+	s.daemonExited = exited
+	s.stateLock.Unlock()
+	announced := s.announceWhenOnBus(exited)
+	defer func() {
+		<-announced
+		s.setViaDbus(false)
+	}()
 
 	scanner := bufio.NewScanner(outReader)
 	log.Infof("scanning stdout")
 	for scanner.Scan() {
 		wire := scanner.Bytes()
 		log.Debugf("wire (length %d): %s", len(wire), wire)
-		err = s.ProcessWire(wire)
-		if err != nil {
-			return err
+		if err = s.ProcessWire(wire); err != nil {
+			log.Errorf("failed to process incoming message: %v", err)
 		}
 	}
-	return nil
+	if err := scanner.Err(); err != nil {
+		log.Errorf("error reading from signal-cli daemon: %v", err)
+	}
+	// stdout has to be drained before we are allowed to Wait
+	err = cmd.Wait()
+	close(exited)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("signal-cli daemon exited")
+}
+
+func (s *Signal) setViaDbus(viaDbus bool) {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	s.viaDbus = viaDbus
+}
+
+func (s *Signal) usingDbus() bool {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	return s.viaDbus
+}
+
+// cliArgs prefixes the arguments for a signal-cli command so that it goes through the running
+// daemon if there is one, otherwise straight to signal-cli for our user.
+func (s *Signal) cliArgs(args ...string) []string {
+	if s.usingDbus() {
+		return append([]string{"--dbus"}, args...)
+	}
+	return append([]string{"-u", s.uname}, args...)
+}
+
+// run executes a signal-cli command (see cliArgs) and returns what it writes to stdout
+func (s *Signal) run(args ...string) ([]byte, error) {
+	cmd := exec.Command("signal-cli", s.cliArgs(args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, s.fail(err)
+	}
+	return out, nil
+}
+
+// recipientArgs returns the signal-cli arguments that address either a number or a group
+func recipientArgs(dest string, isGroup bool) []string {
+	if isGroup {
+		return []string{"-g", dest}
+	}
+	if !strings.HasPrefix(dest, "+") {
+		dest = fmt.Sprintf("+%s", dest)
+	}
+	return []string{dest}
+}
+
+// SendOptions are optional extras for a message we send
+type SendOptions struct {
+	// Attachments are paths to files to attach
+	Attachments []string
+	// QuoteTimestamp and QuoteAuthor identify the message we are replying to
+	QuoteTimestamp int64
+	QuoteAuthor    string
+	// Mentions are the group members mentioned in the message
+	Mentions []*Mention
+	// EditTimestamp is the timestamp of our earlier message that this one replaces
+	EditTimestamp int64
+}
+
+// mentionArgs formats mentions for signal-cli
+func mentionArgs(mentions []*Mention) []string {
+	args := make([]string, 0, len(mentions))
+	for _, m := range mentions {
+		args = append(args, m.String())
+	}
+	return args
+}
+
+// SendMessage sends a message to a number or group, through the daemon if it is running. Returns
+// the message ID.
+func (s *Signal) SendMessage(dest string, isGroup bool, msg string, opts *SendOptions) (int64, error) {
+	args := append([]string{"send"}, recipientArgs(dest, isGroup)...)
+	args = append(args, "-m", msg)
+	if opts != nil {
+		if opts.QuoteTimestamp != 0 {
+			args = append(args,
+				"--quote-timestamp", strconv.FormatInt(opts.QuoteTimestamp, 10),
+				"--quote-author", opts.QuoteAuthor)
+		}
+		if opts.EditTimestamp != 0 {
+			args = append(args, "--edit-timestamp", strconv.FormatInt(opts.EditTimestamp, 10))
+		}
+		if len(opts.Mentions) > 0 {
+			args = append(args, "--mention")
+			args = append(args, mentionArgs(opts.Mentions)...)
+		}
+		// attachments go last since -a takes any number of arguments
+		if len(opts.Attachments) > 0 {
+			args = append(args, "-a")
+			args = append(args, opts.Attachments...)
+		}
+	}
+	out, err := s.run(args...)
+	if err != nil {
+		return 0, err
+	}
+	ID, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return ID, nil
 }
 
 // Send transmits a message to the specified number
@@ -306,8 +502,7 @@ func (s *Signal) Send(dest, msg string) (int64, error) {
 	cmd := exec.Command("signal-cli", "-u", s.uname, "send", dest, "-m", msg)
 	out, err := cmd.Output()
 	if err != nil {
-		s.publishError(err)
-		return 0, err
+		return 0, s.fail(err)
 	}
 	ID, err := strconv.Atoi(string(out[:len(out)-1])) //strip newline
 	if err != nil {
@@ -331,8 +526,7 @@ func (s *Signal) SendDbus(dest, msg string, attachments ...string) (int64, error
 	cmd := exec.Command("signal-cli", args...)
 	out, err := cmd.Output()
 	if err != nil {
-		s.publishError(err)
-		return 0, err
+		return 0, s.fail(err)
 	}
 	ID, err := strconv.Atoi(string(out[:len(out)-1])) //strip newline
 	if err != nil {
@@ -352,8 +546,7 @@ func (s *Signal) SendGroupDbus(groupID, msg string, attachments ...string) (int6
 	cmd := exec.Command("signal-cli", args...)
 	out, err := cmd.Output()
 	if err != nil {
-		s.publishError(err)
-		return 0, err
+		return 0, s.fail(err)
 	}
 	ID, err := strconv.Atoi(string(out[:len(out)-1])) //strip newline
 	if err != nil {
@@ -362,12 +555,307 @@ func (s *Signal) SendGroupDbus(groupID, msg string, attachments ...string) (int6
 	return int64(ID), nil
 }
 
-// RequestGroupInfo requests info for all groups from the Signal network
+// SendRemoteDelete deletes a message that we sent at `targetTimestamp` for everyone
+func (s *Signal) SendRemoteDelete(dest string, isGroup bool, targetTimestamp int64) error {
+	args := []string{"remoteDelete", "-t", strconv.FormatInt(targetTimestamp, 10)}
+	args = append(args, recipientArgs(dest, isGroup)...)
+	_, err := s.run(args...)
+	return err
+}
+
+// SetExpiration sets the disappearing message timer for a contact or group, in seconds. 0 turns
+// it off.
+func (s *Signal) SetExpiration(dest string, isGroup bool, seconds int64) error {
+	command := "updateContact"
+	if isGroup {
+		command = "updateGroup"
+	}
+	args := append([]string{command}, recipientArgs(dest, isGroup)...)
+	args = append(args, "-e", strconv.FormatInt(seconds, 10))
+	_, err := s.run(args...)
+	return err
+}
+
+// SendReadReceipt tells `dest` that we read their messages sent at `timestamps`
+func (s *Signal) SendReadReceipt(dest string, timestamps []int64) error {
+	_, err := s.run(readReceiptArgs(dest, timestamps)...)
+	return err
+}
+
+// readReceiptArgs returns the signal-cli arguments for a read receipt. The recipient goes first,
+// since -t takes every number after it as a timestamp.
+func readReceiptArgs(dest string, timestamps []int64) []string {
+	args := append([]string{"sendReceipt"}, recipientArgs(dest, false)...)
+	args = append(args, "--type", "read", "-t")
+	for _, ts := range timestamps {
+		args = append(args, strconv.FormatInt(ts, 10))
+	}
+	return args
+}
+
+// UpdateContact sets the name we have for a contact
+func (s *Signal) UpdateContact(number string, name string) error {
+	args := append([]string{"updateContact"}, recipientArgs(number, false)...)
+	args = append(args, "-n", name)
+	_, err := s.run(args...)
+	return err
+}
+
+// RemoveContact forgets a contact
+func (s *Signal) RemoveContact(number string) error {
+	args := append([]string{"removeContact"}, recipientArgs(number, false)...)
+	_, err := s.run(args...)
+	return err
+}
+
+// Block stops messages from a number or group from reaching us
+func (s *Signal) Block(dest string, isGroup bool) error {
+	args := append([]string{"block"}, recipientArgs(dest, isGroup)...)
+	_, err := s.run(args...)
+	return err
+}
+
+// Unblock lets messages from a number or group reach us again
+func (s *Signal) Unblock(dest string, isGroup bool) error {
+	args := append([]string{"unblock"}, recipientArgs(dest, isGroup)...)
+	_, err := s.run(args...)
+	return err
+}
+
+// Trust levels signal-cli reports for an identity key
+const (
+	TrustedVerified   = "TRUSTED_VERIFIED"
+	TrustedUnverified = "TRUSTED_UNVERIFIED"
+	Untrusted         = "UNTRUSTED"
+)
+
+// Identity is an identity key we have seen for a contact, as reported by
+// `signal-cli listIdentities`
+type Identity struct {
+	Number                string `json:"number"`
+	UUID                  string `json:"uuid"`
+	Fingerprint           string `json:"fingerprint"`
+	SafetyNumber          string `json:"safetyNumber"`
+	ScannableSafetyNumber string `json:"scannableSafetyNumber"`
+	TrustLevel            string `json:"trustLevel"`
+	AddedTimestamp        int64  `json:"addedTimestamp"`
+}
+
+// Verified returns true if we have checked this key against the contact's safety number
+func (id *Identity) Verified() bool {
+	return id.TrustLevel == TrustedVerified
+}
+
+// TrustText describes the trust level
+func (id *Identity) TrustText() string {
+	switch id.TrustLevel {
+	case TrustedVerified:
+		return "verified"
+	case TrustedUnverified:
+		return "trusted, not verified"
+	case Untrusted:
+		return "untrusted"
+	}
+	return strings.ToLower(id.TrustLevel)
+}
+
+// SafetyNumberGroups splits the safety number into the groups of five digits that signal shows
+func (id *Identity) SafetyNumberGroups() []string {
+	groups := make([]string, 0)
+	sn := strings.Join(strings.Fields(id.SafetyNumber), "")
+	for len(sn) > 5 {
+		groups = append(groups, sn[:5])
+		sn = sn[5:]
+	}
+	if sn != "" {
+		groups = append(groups, sn)
+	}
+	return groups
+}
+
+// ListIdentities lists the identity keys we know for a number, or for everybody if number is
+// empty
+func (s *Signal) ListIdentities(number string) ([]*Identity, error) {
+	args := []string{"-o", "json", "listIdentities"}
+	if number != "" {
+		args = append(args, "-n", recipientArgs(number, false)[0])
+	}
+	out, err := s.run(args...)
+	if err != nil {
+		return nil, err
+	}
+	identities := []*Identity{}
+	if err = json.Unmarshal(out, &identities); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// Trust marks a number's identity key as verified if it matches safetyNumber. If safetyNumber
+// is empty, every key we know for the number is trusted instead, without verifying it.
+func (s *Signal) Trust(number string, safetyNumber string) error {
+	args := append([]string{"trust"}, recipientArgs(number, false)...)
+	if safetyNumber == "" {
+		args = append(args, "-a")
+	} else {
+		args = append(args, "-v", safetyNumber)
+	}
+	_, err := s.run(args...)
+	return err
+}
+
+// GroupUpdate describes a new group or changes to an existing one. Anything left empty is left
+// alone.
+type GroupUpdate struct {
+	Name        string
+	Description string
+	// Avatar is the path to an image file
+	Avatar        string
+	AddMembers    []string
+	RemoveMembers []string
+	AddAdmins     []string
+	RemoveAdmins  []string
+}
+
+// args returns the `signal-cli updateGroup` arguments for the update
+func (u *GroupUpdate) args() []string {
+	args := make([]string, 0)
+	if u.Name != "" {
+		args = append(args, "-n", u.Name)
+	}
+	if u.Description != "" {
+		args = append(args, "-d", u.Description)
+	}
+	if u.Avatar != "" {
+		args = append(args, "-a", u.Avatar)
+	}
+	lists := []struct {
+		flag    string
+		numbers []string
+	}{
+		{"-m", u.AddMembers},
+		{"-r", u.RemoveMembers},
+		{"--admin", u.AddAdmins},
+		{"--remove-admin", u.RemoveAdmins},
+	}
+	for _, list := range lists {
+		if len(list.numbers) > 0 {
+			args = append(args, list.flag)
+			args = append(args, list.numbers...)
+		}
+	}
+	return args
+}
+
+// createdGroupPattern finds the new group ID in the output of `signal-cli updateGroup`
+var createdGroupPattern = regexp.MustCompile(`"([^"]+)"`)
+
+// UpdateGroup changes a group, or creates a new one if `groupID` is empty. Returns the group ID.
+func (s *Signal) UpdateGroup(groupID string, update *GroupUpdate) (string, error) {
+	args := []string{"updateGroup"}
+	if groupID != "" {
+		args = append(args, recipientArgs(groupID, true)...)
+	}
+	args = append(args, update.args()...)
+	out, err := s.run(args...)
+	if err != nil {
+		return "", err
+	}
+	if groupID != "" {
+		return groupID, nil
+	}
+	match := createdGroupPattern.FindSubmatch(out)
+	if match == nil {
+		return "", fmt.Errorf("couldn't find the new group ID in: %s", out)
+	}
+	return string(match[1]), nil
+}
+
+// ProfileUpdate describes changes to our own profile. Anything left empty is left alone.
+type ProfileUpdate struct {
+	GivenName  string
+	FamilyName string
+	About      string
+	AboutEmoji string
+	// Avatar is the path to an image file
+	Avatar       string
+	RemoveAvatar bool
+}
+
+// Name returns the new profile name, or "" if the update doesn't change it. Signal needs a given
+// name, so a family name on its own doesn't count.
+func (u *ProfileUpdate) Name() string {
+	if u.GivenName == "" {
+		return ""
+	}
+	return strings.TrimSpace(u.GivenName + " " + u.FamilyName)
+}
+
+// args returns the `signal-cli updateProfile` arguments for the update
+func (u *ProfileUpdate) args() []string {
+	args := make([]string, 0)
+	flags := []struct {
+		flag  string
+		value string
+	}{
+		{"--given-name", u.GivenName},
+		{"--family-name", u.FamilyName},
+		{"--about", u.About},
+		{"--about-emoji", u.AboutEmoji},
+		{"--avatar", u.Avatar},
+	}
+	for _, f := range flags {
+		if f.value != "" {
+			args = append(args, f.flag, f.value)
+		}
+	}
+	if u.RemoveAvatar {
+		args = append(args, "--remove-avatar")
+	}
+	return args
+}
+
+// UpdateProfile changes our own profile
+func (s *Signal) UpdateProfile(update *ProfileUpdate) error {
+	_, err := s.run(append([]string{"updateProfile"}, update.args()...)...)
+	return err
+}
+
+// QuitGroup leaves a group
+func (s *Signal) QuitGroup(groupID string) error {
+	_, err := s.run(append([]string{"quitGroup"}, recipientArgs(groupID, true)...)...)
+	return err
+}
+
+// SendTyping tells a number or group that we started typing, or stopped if `stop` is true
+func (s *Signal) SendTyping(dest string, isGroup bool, stop bool) error {
+	args := []string{"sendTyping"}
+	if stop {
+		args = append(args, "-s")
+	}
+	args = append(args, recipientArgs(dest, isGroup)...)
+	_, err := s.run(args...)
+	return err
+}
+
+// SendReaction reacts to the message sent by `targetAuthor` at `targetTimestamp` with an emoji.
+// If `remove` is set, the reaction is removed instead.
+func (s *Signal) SendReaction(dest string, isGroup bool, emoji, targetAuthor string, targetTimestamp int64, remove bool) error {
+	args := []string{"sendReaction", "-e", emoji, "-a", targetAuthor,
+		"-t", strconv.FormatInt(targetTimestamp, 10)}
+	if remove {
+		args = append(args, "-r")
+	}
+	args = append(args, recipientArgs(dest, isGroup)...)
+	_, err := s.run(args...)
+	return err
+}
+
+// RequestGroupInfo requests info for all groups from the Signal network, through the daemon if it
+// is running
 func (s *Signal) RequestGroupInfo() ([]SignalGroupInfo, error) {
-	cmd := exec.Command("signal-cli", "-o", "json", "-u", s.uname, "listGroups")
-	out, err := cmd.Output()
+	out, err := s.run("-o", "json", "listGroups")
 	if err != nil {
-		s.publishError(err)
 		return nil, err
 	}
 	groupInfo := []SignalGroupInfo{}
@@ -380,101 +868,176 @@ func (s *Signal) RequestGroupInfo() ([]SignalGroupInfo, error) {
 // Link will attempt to link to an existing registered device.
 func (s *Signal) Link(deviceName string) error {
 	cmd := exec.Command("signal-cli", "link", "-n", deviceName)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
 	out, err := cmd.StdoutPipe()
 	if err != nil {
 		return err
 	}
 	err = cmd.Start()
 	if err != nil {
-		return err
+		return Classify(err)
 	}
 	r := bufio.NewReader(out)
 	line, _, err := r.ReadLine()
 	if err != nil {
-		return err
+		// signal-cli gave up before printing a link, so why is on stderr
+		return linkError(cmd.Wait(), stderr.Bytes(), err)
 	}
 	fmt.Printf("link text: %s\n", line)
 	qr.Generate(fmt.Sprintf("%s", line), qr.L, os.Stdout)
-	return cmd.Wait()
+	return linkError(cmd.Wait(), stderr.Bytes(), nil)
+}
+
+// linkError classifies how `signal-cli link` failed, using what it wrote to stderr. `readErr` is
+// returned if the command itself succeeded.
+func linkError(waitErr error, stderr []byte, readErr error) error {
+	if waitErr == nil {
+		return readErr
+	}
+	var exitErr *exec.ExitError
+	if errors.As(waitErr, &exitErr) {
+		exitErr.Stderr = stderr
+	}
+	return Classify(waitErr)
+}
+
+// CaptchaURL is where to get a captcha token when signal asks for one while registering
+const CaptchaURL = "https://signalcaptchas.org/registration/generate.html"
+
+// Register asks signal to send a verification code to our number, by SMS or a voice call. Signal
+// often wants a captcha token first, see CaptchaURL.
+func (s *Signal) Register(voice bool, captcha string) error {
+	args := []string{"-u", s.uname, "register"}
+	if voice {
+		args = append(args, "--voice")
+	}
+	if captcha != "" {
+		args = append(args, "--captcha", captcha)
+	}
+	return onboard(args...)
+}
+
+// Verify finishes registering with the code we were sent. `pin` is the registration lock PIN, if
+// the account has one.
+func (s *Signal) Verify(code string, pin string) error {
+	args := []string{"-u", s.uname, "verify", strings.ReplaceAll(code, "-", "")}
+	if pin != "" {
+		args = append(args, "--pin", pin)
+	}
+	return onboard(args...)
+}
+
+// onboard runs a register or verify command. Failures are classified, so that Describe can say
+// what to do about them.
+func onboard(args ...string) error {
+	_, err := Exec(args...)
+	return Classify(err)
 }
 
 // GetUserData returns the user data for the current user.
 // this is where the contact list is kept for signal-cli < 0.8.2
 func (s *Signal) GetUserData() (*SignalUserData, error) {
-	usr, err := user.Current()
+	dataFolder, err := GetSignalDataFolder()
 	if err != nil {
 		return nil, err
 	}
-	homeDir := usr.HomeDir
-	dataFile := fmt.Sprintf("%s/%s/%s", homeDir, SignalDataDir, s.uname)
-	b, err := ioutil.ReadFile(dataFile)
-	if err != nil {
-		return nil, err
-	}
-	userData := &SignalUserData{}
-	if err = json.Unmarshal(b, userData); err != nil {
-		return nil, err
-	}
-	return userData, nil
+	return readUserData(filepath.Join(dataFolder, s.uname))
 }
 
 // GetRecipientStore gets the recipient store. This is where the contacts list is kept in
 // signal-cli >= 0.8.2
 func (s *Signal) GetRecipientStore() (*SignalRecipientStore, error) {
-	usr, err := user.Current()
-	if err != nil {
-		return nil, err
-	}
-	homeDir := usr.HomeDir
-	dataFile := fmt.Sprintf("%s/%s/%s.d/recipients-store", homeDir, SignalDataDir, s.uname)
-	b, err := ioutil.ReadFile(dataFile)
+	dataFolder, err := GetSignalDataFolder()
 	if err != nil {
 		return nil, err
 	}
-	store := &SignalRecipientStore{}
-	if err = json.Unmarshal(b, store); err != nil {
-		return nil, err
-	}
-	return store, nil
+	return readRecipientStore(filepath.Join(dataFolder, s.uname+".d", "recipients-store"))
+}
+
+// Storage returns the storage adapter that matches the installed version of signal-cli.
+// Whatever isn't on disk is asked of the backend we are part of, instead of a separate signal-cli.
+func (s *Signal) Storage() Storage {
+	s.storageOnce.Do(func() {
+		version, err := s.Version()
+		if err != nil {
+			log.Warnf("couldn't get signal-cli version, guessing storage layout: %v", err)
+		}
+		var lister ContactLister = s
+		if s.lister != nil {
+			lister = s.lister
+		}
+		s.storage = newStorage(lister, s.uname, strings.TrimSpace(version))
+	})
+	return s.storage
 }
 
 // GetContactList attempts to read an existing contact list from the signal user directory.
 func (s *Signal) GetContactList() ([]*SignalContact, error) {
-	recipients, err := s.GetRecipientStore()
-	if err != nil {
-		return nil, err
-	}
-	// recipients stored in `recipients-store` file
-	return recipients.AsContacts(), nil
+	return s.Storage().Contacts()
 }
 
 // GetGroupList attempts to read an existing contact list from the signal user directory.
 func (s *Signal) GetGroupList() ([]*SignalGroup, error) {
-	userData, err := s.GetUserData()
+	return s.Storage().Groups()
+}
+
+// ListContacts asks signal-cli for our contacts, through the daemon if it is running
+func (s *Signal) ListContacts() ([]*SignalContact, error) {
+	out, err := s.run("-o", "json", "listContacts")
 	if err != nil {
 		return nil, err
 	}
-	return userData.GroupStore.Groups, nil
+	contacts := []*SignalContact{}
+	if err = json.Unmarshal(out, &contacts); err != nil {
+		return nil, err
+	}
+	for _, c := range contacts {
+		c.Blocked = c.Blocked || c.IsBlocked
+	}
+	return contacts, nil
 }
 
 // ProcessWire processes a single wire message, executing any callbacks we
 // have registered.
 func (s *Signal) ProcessWire(wire []byte) error {
+	s.record(wire)
 	var msg Message
 	err := json.Unmarshal(wire, &msg)
 	if err != nil {
 		log.Printf("failed to unmarshal message: %s - %s", wire, err)
 		return err
 	}
+	if msg.Envelope == nil {
+		log.Debugf("ignoring wire message without an envelope: %s", wire)
+		return nil
+	}
+	return s.dispatch(&msg)
+}
+
+// ProcessMessage executes any callbacks we have registered for a message that has already been
+// decoded. Backends that don't get their messages as JSON (like dbus) can use this directly.
+func (s *Signal) ProcessMessage(msg *Message) error {
+	if s.recorder != nil {
+		if wire, err := json.Marshal(msg); err == nil {
+			s.record(wire)
+		}
+	}
+	return s.dispatch(msg)
+}
+
+// dispatch executes the callbacks for a decoded message
+func (s *Signal) dispatch(msg *Message) error {
+	var err error
 	for _, cb := range s.msgCallbacks {
-		err = cb(&msg)
+		err = cb(msg)
 		if err != nil {
 			return err
 		}
 	}
 	if msg.Envelope.DataMessage != nil {
 		for _, cb := range s.receivedCallbacks {
-			err = cb(&msg)
+			err = cb(msg)
 			if err != nil {
 				return err
 			}
@@ -483,7 +1046,15 @@ func (s *Signal) ProcessWire(wire []byte) error {
 	if msg.Envelope.SyncMessage != nil {
 		if msg.Envelope.SyncMessage.SentMessage != nil {
 			for _, cb := range s.sentCallbacks {
-				err = cb(&msg)
+				err = cb(msg)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if len(msg.Envelope.SyncMessage.ReadMessages) > 0 {
+			for _, cb := range s.readSyncCallbacks {
+				err = cb(msg)
 				if err != nil {
 					return err
 				}
@@ -492,7 +1063,31 @@ func (s *Signal) ProcessWire(wire []byte) error {
 	}
 	if msg.Envelope.ReceiptMessage != nil {
 		for _, cb := range s.receiptCallbacks {
-			err = cb(&msg)
+			err = cb(msg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if msg.Envelope.TypingMessage != nil {
+		for _, cb := range s.typingCallbacks {
+			err = cb(msg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if msg.Envelope.CallMessage != nil {
+		for _, cb := range s.callCallbacks {
+			err = cb(msg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if msg.Envelope.EditMessage != nil {
+		for _, cb := range s.editCallbacks {
+			err = cb(msg)
 			if err != nil {
 				return err
 			}
@@ -503,9 +1098,13 @@ func (s *Signal) ProcessWire(wire []byte) error {
 
 // Close cleans up any subprocesses
 func (s *Signal) Close() {
-	if s.daemon != nil {
-		log.Debug("killing signal-cli daemon...")
-		_ = s.daemon.Process.Signal(os.Interrupt)
+	s.stateLock.Lock()
+	s.stopped = true
+	daemon, exited := s.daemon, s.daemonExited
+	s.stateLock.Unlock()
+	if daemon != nil {
+		log.Debug("stopping signal-cli daemon...")
+		stopProcess(daemon, exited)
 	}
 }
 
@@ -0,0 +1,27 @@
+package signal
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentity(t *testing.T) {
+	wire := `[{"number":"+15555555551","safetyNumber":"123451234512345123451234512345123451234512345123451234512345","trustLevel":"TRUSTED_UNVERIFIED","addedTimestamp":1600000000000}]`
+	identities := []*Identity{}
+	assert.NoError(t, json.Unmarshal([]byte(wire), &identities))
+	id := identities[0]
+	assert.False(t, id.Verified())
+	assert.Equal(t, "trusted, not verified", id.TrustText())
+	groups := id.SafetyNumberGroups()
+	assert.Len(t, groups, 12)
+	assert.Equal(t, "12345", groups[11])
+}
+
+func TestReadReceiptArgs(t *testing.T) {
+	// -t would take the recipient as another timestamp, so it has to come first
+	assert.Equal(t,
+		[]string{"sendReceipt", "+15555555551", "--type", "read", "-t", "1600000000000", "1600000000001"},
+		readReceiptArgs("15555555551", []int64{1600000000000, 1600000000001}))
+}
@@ -0,0 +1,291 @@
+package signal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Storage reads the contacts and groups that signal-cli keeps for an account. signal-cli changes
+// its on-disk layout every few releases, so there is one implementation per layout. Use
+// NewStorage to get the right one for a given version of signal-cli.
+type Storage interface {
+	Contacts() ([]*SignalContact, error)
+	Groups() ([]*SignalGroup, error)
+}
+
+// ContactLister asks signal-cli for contacts and groups. Storage adapters fall back to it for
+// anything that isn't on disk. It should be the backend we are running, so that we don't start a
+// second signal-cli that fights the first one for the account.
+type ContactLister interface {
+	ListContacts() ([]*SignalContact, error)
+	RequestGroupInfo() ([]SignalGroupInfo, error)
+}
+
+// Version is a parsed signal-cli version
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// Less returns whether v is older than other
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// ParseVersion parses a signal-cli version like "0.9.2". Anything after the patch number (like
+// "-SNAPSHOT") is ignored.
+func ParseVersion(version string) (Version, error) {
+	v := Version{}
+	parts := strings.SplitN(strings.TrimSpace(version), ".", 3)
+	if len(parts) < 2 {
+		return v, fmt.Errorf("unrecognized signal-cli version: %s", version)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		digits := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' })
+		if digits == 0 {
+			return v, fmt.Errorf("unrecognized signal-cli version: %s", version)
+		} else if digits > 0 {
+			part = part[:digits]
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return v, fmt.Errorf("unrecognized signal-cli version: %s", version)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+var (
+	// recipientStoreVersion is the first version that keeps contacts in `recipients-store`
+	recipientStoreVersion = Version{0, 8, 2}
+	// accountsVersion is the first version that keeps accounts in `accounts.json`
+	accountsVersion = Version{0, 10, 0}
+)
+
+// NewStorage returns the storage adapter for the given signal-cli version. If the version is
+// unknown we look at what is on disk to guess.
+func NewStorage(s *Signal, version string) Storage {
+	return newStorage(s, s.uname, version)
+}
+
+// newStorage returns the storage adapter for `uname` and the given signal-cli version, which asks
+// `backend` for anything it can't find on disk
+func newStorage(backend ContactLister, uname string, version string) Storage {
+	dataFolder, err := GetSignalDataFolder()
+	if err != nil {
+		log.Warnf("couldn't find signal-cli data folder, asking signal-cli instead: %v", err)
+		return &cliStorage{signal: backend}
+	}
+	v, err := ParseVersion(version)
+	if err != nil {
+		return detectStorage(backend, uname, dataFolder)
+	}
+	log.Debugf("using storage layout for signal-cli %s", v)
+	if v.Less(recipientStoreVersion) {
+		return &userDataStorage{dataFolder: dataFolder, uname: uname}
+	}
+	if v.Less(accountsVersion) {
+		return &recipientStorage{dataFolder: dataFolder, uname: uname}
+	}
+	return &accountStorage{dataFolder: dataFolder, uname: uname, signal: backend}
+}
+
+// detectStorage picks a storage adapter based on which files exist
+func detectStorage(backend ContactLister, uname string, dataFolder string) Storage {
+	if exists(filepath.Join(dataFolder, "accounts.json")) {
+		return &accountStorage{dataFolder: dataFolder, uname: uname, signal: backend}
+	}
+	if exists(filepath.Join(dataFolder, uname+".d", "recipients-store")) {
+		return &recipientStorage{dataFolder: dataFolder, uname: uname}
+	}
+	if exists(filepath.Join(dataFolder, uname)) {
+		return &userDataStorage{dataFolder: dataFolder, uname: uname}
+	}
+	return &cliStorage{signal: backend}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func readUserData(path string) (*SignalUserData, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	userData := &SignalUserData{}
+	if err = json.Unmarshal(b, userData); err != nil {
+		return nil, err
+	}
+	return userData, nil
+}
+
+func readRecipientStore(path string) (*SignalRecipientStore, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	store := &SignalRecipientStore{}
+	if err = json.Unmarshal(b, store); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// userDataStorage is the layout for signal-cli < 0.8.2, where everything lives in a single JSON
+// file at data/<number>
+type userDataStorage struct {
+	dataFolder string
+	uname      string
+}
+
+func (u *userDataStorage) Contacts() ([]*SignalContact, error) {
+	userData, err := readUserData(filepath.Join(u.dataFolder, u.uname))
+	if err != nil {
+		return nil, err
+	}
+	return userData.ContactStore.Contacts, nil
+}
+
+func (u *userDataStorage) Groups() ([]*SignalGroup, error) {
+	userData, err := readUserData(filepath.Join(u.dataFolder, u.uname))
+	if err != nil {
+		return nil, err
+	}
+	return userData.GroupStore.Groups, nil
+}
+
+// recipientStorage is the layout for signal-cli 0.8.2 up to 0.10. Contacts moved to
+// data/<number>.d/recipients-store, groups are still in data/<number>
+type recipientStorage struct {
+	dataFolder string
+	uname      string
+}
+
+func (r *recipientStorage) Contacts() ([]*SignalContact, error) {
+	store, err := readRecipientStore(filepath.Join(r.dataFolder, r.uname+".d", "recipients-store"))
+	if err != nil {
+		return nil, err
+	}
+	return store.AsContacts(), nil
+}
+
+func (r *recipientStorage) Groups() ([]*SignalGroup, error) {
+	userData, err := readUserData(filepath.Join(r.dataFolder, r.uname))
+	if err != nil {
+		return nil, err
+	}
+	return userData.GroupStore.Groups, nil
+}
+
+// SignalAccount is an entry in signal-cli's `accounts.json`
+type SignalAccount struct {
+	Path        string `json:"path"`
+	Environment string `json:"environment"`
+	Number      string `json:"number"`
+	UUID        string `json:"uuid"`
+}
+
+// SignalAccounts is the format of signal-cli's `accounts.json` (signal-cli >= 0.10)
+type SignalAccounts struct {
+	Accounts []*SignalAccount `json:"accounts"`
+	Version  int              `json:"version"`
+}
+
+// accountStorage is the layout for signal-cli >= 0.10. Accounts are listed in accounts.json and
+// each one gets a data/<path> file and data/<path>.d folder. Newer releases moved most of that
+// into a database we can't read, so whenever the JSON files aren't there we ask signal-cli.
+type accountStorage struct {
+	dataFolder string
+	uname      string
+	signal     ContactLister
+}
+
+// accountPath returns the data/<path> prefix for our account
+func (a *accountStorage) accountPath() (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(a.dataFolder, "accounts.json"))
+	if err != nil {
+		return "", err
+	}
+	accounts := &SignalAccounts{}
+	if err = json.Unmarshal(b, accounts); err != nil {
+		return "", err
+	}
+	for _, account := range accounts.Accounts {
+		if account.Number == a.uname {
+			return filepath.Join(a.dataFolder, account.Path), nil
+		}
+	}
+	return "", fmt.Errorf("account %s not found in accounts.json", a.uname)
+}
+
+func (a *accountStorage) Contacts() ([]*SignalContact, error) {
+	path, err := a.accountPath()
+	if err == nil {
+		store, err := readRecipientStore(filepath.Join(path+".d", "recipients-store"))
+		if err == nil {
+			return store.AsContacts(), nil
+		}
+	}
+	log.Debugf("no recipient store on disk, asking signal-cli for contacts")
+	return a.signal.ListContacts()
+}
+
+func (a *accountStorage) Groups() ([]*SignalGroup, error) {
+	path, err := a.accountPath()
+	if err == nil {
+		userData, err := readUserData(path)
+		if err == nil && len(userData.GroupStore.Groups) > 0 {
+			return userData.GroupStore.Groups, nil
+		}
+	}
+	log.Debugf("no group store on disk, asking signal-cli for groups")
+	return (&cliStorage{signal: a.signal}).Groups()
+}
+
+// cliStorage doesn't read anything from disk, it asks the backend (`signal-cli listContacts` and
+// `signal-cli listGroups`) instead.
+type cliStorage struct {
+	signal ContactLister
+}
+
+func (c *cliStorage) Contacts() ([]*SignalContact, error) {
+	return c.signal.ListContacts()
+}
+
+func (c *cliStorage) Groups() ([]*SignalGroup, error) {
+	info, err := c.signal.RequestGroupInfo()
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]*SignalGroup, 0, len(info))
+	for _, g := range info {
+		groups = append(groups, &SignalGroup{
+			GroupID: g.ID,
+			Name:    g.Name,
+			Blocked: g.IsBlocked,
+		})
+	}
+	return groups, nil
+}
@@ -0,0 +1,125 @@
+package signal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testNumber = "+15555555555"
+
+// setupDataFolder points signal-cli's data folder at a temporary directory and writes `files`
+// (relative path -> contents) into it
+func setupDataFolder(t *testing.T, files map[string]string) {
+	dir, err := ioutil.TempDir("", "siggo-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldXDG := os.Getenv("XDG_DATA_HOME")
+	os.Setenv("XDG_DATA_HOME", dir)
+	t.Cleanup(func() {
+		os.Setenv("XDG_DATA_HOME", oldXDG)
+		os.RemoveAll(dir)
+	})
+	for name, contents := range files {
+		path := filepath.Join(dir, "signal-cli", "data", name)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	v, err := ParseVersion("0.9.2\n")
+	assert.Nil(t, err)
+	assert.Equal(t, Version{0, 9, 2}, v)
+	v, err = ParseVersion("0.11.5-SNAPSHOT")
+	assert.Nil(t, err)
+	assert.Equal(t, Version{0, 11, 5}, v)
+	assert.True(t, Version{0, 8, 1}.Less(recipientStoreVersion))
+	assert.False(t, Version{0, 10, 0}.Less(accountsVersion))
+	_, err = ParseVersion("")
+	assert.NotNil(t, err)
+}
+
+func TestUserDataStorage(t *testing.T) {
+	setupDataFolder(t, map[string]string{
+		testNumber: `{
+			"contactStore": {"contacts": [{"name": "Leeloo", "number": "+15555555556"}]},
+			"groupStore": {"groups": [{"groupId": "abc=", "blocked": true}]}
+		}`,
+	})
+	store := NewStorage(NewSignal(testNumber), "0.7.4")
+	assert.IsType(t, &userDataStorage{}, store)
+	contacts, err := store.Contacts()
+	assert.Nil(t, err)
+	assert.Equal(t, "Leeloo", contacts[0].Name)
+	groups, err := store.Groups()
+	assert.Nil(t, err)
+	assert.Equal(t, "abc=", groups[0].GroupID)
+	assert.True(t, groups[0].Blocked)
+}
+
+func TestRecipientStorage(t *testing.T) {
+	setupDataFolder(t, map[string]string{
+		testNumber: `{"groupStore": {"groups": [{"groupId": "abc="}]}}`,
+		testNumber + ".d/recipients-store": `{"recipients": [
+			{"id": 1, "number": "+15555555556", "uuid": "u-1", "contact": {"name": "Korben"}}
+		]}`,
+	})
+	for _, version := range []string{"0.9.2", ""} {
+		store := NewStorage(NewSignal(testNumber), version)
+		assert.IsType(t, &recipientStorage{}, store)
+		contacts, err := store.Contacts()
+		assert.Nil(t, err)
+		assert.Equal(t, "Korben", contacts[0].Name)
+		assert.Equal(t, "u-1", contacts[0].UUID)
+		groups, err := store.Groups()
+		assert.Nil(t, err)
+		assert.Equal(t, "abc=", groups[0].GroupID)
+	}
+}
+
+func TestAccountStorage(t *testing.T) {
+	setupDataFolder(t, map[string]string{
+		"accounts.json": `{"accounts": [{"path": "123456", "number": "` + testNumber + `"}], "version": 2}`,
+		"123456":        `{"groupStore": {"groups": [{"groupId": "abc="}]}}`,
+		"123456.d/recipients-store": `{"recipients": [
+			{"id": 1, "number": "+15555555556", "contact": {"name": "Ruby"}}
+		]}`,
+	})
+	for _, version := range []string{"0.10.3", ""} {
+		store := NewStorage(NewSignal(testNumber), version)
+		assert.IsType(t, &accountStorage{}, store)
+		contacts, err := store.Contacts()
+		assert.Nil(t, err)
+		assert.Equal(t, "Ruby", contacts[0].Name)
+		groups, err := store.Groups()
+		assert.Nil(t, err)
+		assert.Equal(t, "abc=", groups[0].GroupID)
+	}
+}
+
+func TestStorageIsPickedOnce(t *testing.T) {
+	setupDataFolder(t, map[string]string{
+		"accounts.json": `{"accounts": [{"path": "123456", "number": "` + testNumber + `"}], "version": 2}`,
+	})
+	calls := filepath.Join(os.Getenv("XDG_DATA_HOME"), "calls")
+	defer fakeSignalCLIPath(t, "echo v >> "+calls+"\necho signal-cli 0.10.3\n")()
+
+	js := NewJSONRPCSignal(testNumber)
+	store := js.Storage()
+	assert.IsType(t, &accountStorage{}, store)
+	assert.True(t, store == js.Storage())
+	// anything that isn't on disk is asked of the jsonRpc backend, not a separate signal-cli
+	assert.Equal(t, js, store.(*accountStorage).signal)
+	b, err := ioutil.ReadFile(calls)
+	assert.Nil(t, err)
+	assert.Equal(t, "v\n", string(b))
+}
@@ -0,0 +1,169 @@
+package signal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ConnState is the state of our connection to signal-cli
+type ConnState int
+
+const (
+	// ConnStarting means signal-cli is starting for the first time
+	ConnStarting ConnState = iota
+	// ConnConnected means signal-cli is running and we are receiving messages
+	ConnConnected
+	// ConnReconnecting means signal-cli went away and we are waiting to restart it
+	ConnReconnecting
+	// ConnFailed means signal-cli keeps failing. We still retry, but not very often.
+	ConnFailed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnStarting:
+		return "starting"
+	case ConnConnected:
+		return "connected"
+	case ConnReconnecting:
+		return "reconnecting"
+	case ConnFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("ConnState(%d)", int(s))
+}
+
+type StateChangeCallback func(ConnState)
+
+// OnStateChange registers a callback to be executed whenever our connection to signal-cli
+// changes state
+func (s *Signal) OnStateChange(callback StateChangeCallback) {
+	s.stateCallbacks = append(s.stateCallbacks, callback)
+}
+
+// State returns the current state of our connection to signal-cli
+func (s *Signal) State() ConnState {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	return s.state
+}
+
+func (s *Signal) setState(state ConnState) {
+	s.stateLock.Lock()
+	changed := s.state != state
+	s.state = state
+	s.stateLock.Unlock()
+	if !changed {
+		return
+	}
+	log.Infof("signal-cli is %s", state)
+	for _, cb := range s.stateCallbacks {
+		cb(state)
+	}
+}
+
+// Backoff hands out exponentially increasing delays between Min and Max
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+
+	next time.Duration
+}
+
+// Next returns how long to wait before the next attempt
+func (b *Backoff) Next() time.Duration {
+	if b.next < b.Min {
+		b.next = b.Min
+	}
+	delay := b.next
+	b.next *= 2
+	if b.next > b.Max {
+		b.next = b.Max
+	}
+	return delay
+}
+
+// Reset starts the delays over from Min
+func (b *Backoff) Reset() {
+	b.next = b.Min
+}
+
+// backoffMin and backoffMax bound how long we wait between restarts of signal-cli
+var (
+	backoffMin = 1 * time.Second
+	backoffMax = 2 * time.Minute
+)
+
+const (
+	// maxFailures is how many times in a row signal-cli can fail before we call it failed
+	maxFailures = 6
+	// stopTimeout is how long signal-cli gets to exit after SIGINT before we kill it
+	stopTimeout = 5 * time.Second
+)
+
+// supervise runs `run` until `closed` returns true, restarting it with exponential backoff
+// whenever it returns. `run` should call setState(ConnConnected) once it is up. A run that stays
+// connected for longer than backoffMax resets the backoff.
+func (s *Signal) supervise(name string, run func() error, closed func() bool) {
+	backoff := &Backoff{Min: backoffMin, Max: backoffMax}
+	failures := 0
+	s.setState(ConnStarting)
+	for !closed() {
+		started := time.Now()
+		err := run()
+		if closed() {
+			return
+		}
+		if s.State() == ConnConnected && time.Since(started) > backoffMax {
+			backoff.Reset()
+			failures = 0
+		}
+		failures++
+		if failures >= maxFailures {
+			s.setState(ConnFailed)
+		} else {
+			s.setState(ConnReconnecting)
+		}
+		delay := backoff.Next()
+		log.Errorf("%s stopped (%v)... restarting in %s...", name, err, delay)
+		time.Sleep(delay)
+	}
+}
+
+// waitProcess reaps a signal-cli process in the background, once `drained` is closed (if we are
+// reading its stdout, we aren't allowed to Wait until we are done). The returned channel is
+// closed once it has exited, and `exitErr` is set to what Wait returned before then.
+func waitProcess(cmd *exec.Cmd, drained <-chan struct{}, exitErr *error) <-chan struct{} {
+	exited := make(chan struct{})
+	go func() {
+		if drained != nil {
+			<-drained
+		}
+		*exitErr = cmd.Wait()
+		close(exited)
+	}()
+	return exited
+}
+
+// stopProcess asks a signal-cli process to exit, kills it if it takes too long, and waits until
+// it has been reaped. `exited` is the channel from waitProcess.
+func stopProcess(cmd *exec.Cmd, exited <-chan struct{}) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	_ = cmd.Process.Signal(os.Interrupt)
+	if exited == nil {
+		return
+	}
+	select {
+	case <-exited:
+	case <-time.After(stopTimeout):
+		log.Warnf("signal-cli didn't exit after %s, killing it", stopTimeout)
+		_ = cmd.Process.Kill()
+		<-exited
+	}
+}
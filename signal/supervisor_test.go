@@ -0,0 +1,56 @@
+package signal
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	b := &Backoff{Min: time.Second, Max: 5 * time.Second}
+	assert.Equal(t, time.Second, b.Next())
+	assert.Equal(t, 2*time.Second, b.Next())
+	assert.Equal(t, 4*time.Second, b.Next())
+	assert.Equal(t, 5*time.Second, b.Next())
+	assert.Equal(t, 5*time.Second, b.Next())
+	b.Reset()
+	assert.Equal(t, time.Second, b.Next())
+}
+
+func TestSupervise(t *testing.T) {
+	oldMin, oldMax := backoffMin, backoffMax
+	backoffMin, backoffMax = time.Millisecond, time.Millisecond
+	t.Cleanup(func() { backoffMin, backoffMax = oldMin, oldMax })
+
+	s := NewSignal(testNumber)
+	states := make([]ConnState, 0)
+	s.OnStateChange(func(state ConnState) { states = append(states, state) })
+	runs := 0
+	s.supervise("test", func() error {
+		runs++
+		if runs == 2 {
+			s.setState(ConnConnected)
+		}
+		return fmt.Errorf("exited")
+	}, func() bool { return runs >= maxFailures+1 })
+
+	assert.Equal(t, maxFailures+1, runs)
+	// we start out starting, so that isn't a change
+	assert.Equal(t, []ConnState{ConnReconnecting, ConnConnected, ConnReconnecting, ConnFailed}, states)
+}
+
+func TestStopProcess(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	bindToParent(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Skipf("can't run sleep: %v", err)
+	}
+	var exitErr error
+	exited := waitProcess(cmd, nil, &exitErr)
+	stopProcess(cmd, exited)
+	assert.Error(t, exitErr)
+	assert.NotNil(t, cmd.ProcessState)
+}
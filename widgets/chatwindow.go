@@ -13,6 +13,7 @@ import (
 
 	"github.com/atotto/clipboard"
 	"github.com/derricw/siggo/model"
+	"github.com/derricw/siggo/signal"
 	"github.com/gdamore/tcell"
 	"github.com/kyokomi/emoji"
 	"github.com/rivo/tview"
@@ -27,6 +28,8 @@ const (
 	YankMode
 	OpenMode
 	LinkMode
+	SelectMode
+	SafetyMode
 )
 
 // stolen from suckoverflow
@@ -36,7 +39,9 @@ var urlRegex = regexp.MustCompile(`https?:\/\/(www\.)?[-a-zA-Z0-9@:%._\+~#=]{1,2
 type ChatWindow struct {
 	// todo: maybe use Flex instead of Grid?
 	*tview.Grid
-	siggo          *model.Siggo
+	siggo *model.Siggo
+	// accounts are all of the accounts we are running. siggo is the one we are looking at.
+	accounts       []*model.Siggo
 	currentContact *model.Contact
 	mode           Mode
 
@@ -88,6 +93,141 @@ func (c *ChatWindow) LinkMode() {
 	c.app.SetFocus(li)
 }
 
+// SafetyMode shows the safety numbers of the current contact so that we can verify them
+func (c *ChatWindow) SafetyMode() {
+	log.Debug("SAFETY MODE")
+	if c.currentContact == nil {
+		return
+	}
+	c.mode = SafetyMode
+	sp := NewSafetyPanel(c)
+	c.HideConversation(sp)
+	c.app.SetFocus(sp)
+}
+
+// SelectMode lets us pick a message from the current conversation. Only messages that pass
+// `filter` are offered and `onSelect` is called with the one we choose.
+func (c *ChatWindow) SelectMode(title string, filter func(*model.Message) bool, onSelect func(*model.Message)) {
+	log.Debug("SELECT MODE")
+	c.mode = SelectMode
+	ms := NewMessageSelect(c, title, filter, onSelect)
+	c.HideConversation(ms)
+	c.app.SetFocus(ms)
+}
+
+// ReactMode selects a message to react to
+func (c *ChatWindow) ReactMode() {
+	c.SelectMode("react", isLiveMessage, c.ShowReactInput)
+}
+
+// ReplyMode selects a message to reply to
+func (c *ChatWindow) ReplyMode() {
+	c.SelectMode("reply", isLiveMessage, c.Reply)
+}
+
+// Reply stages `msg` to be quoted by the next message we send
+func (c *ChatWindow) Reply(msg *model.Message) {
+	conv, err := c.currentConversation()
+	if err != nil {
+		c.SetErrorStatus(err)
+		return
+	}
+	conv.StageQuote(msg)
+	c.sendPanel.Update()
+	c.InsertMode()
+}
+
+// DeleteMode selects one of our own messages to delete for everyone
+func (c *ChatWindow) DeleteMode() {
+	c.SelectMode("delete for everyone", func(msg *model.Message) bool {
+		return msg.FromSelf && !msg.IsDeleted && msg.SendState == ""
+	}, c.DeleteForEveryone)
+}
+
+// DeleteForEveryone deletes one of our messages in the current conversation for everyone
+func (c *ChatWindow) DeleteForEveryone(msg *model.Message) {
+	contact := c.currentContact
+	c.NormalMode()
+	go func() {
+		if err := c.siggo.DeleteForEveryone(contact, msg); err != nil {
+			c.SetErrorStatus(fmt.Errorf("failed to delete message: %w", err))
+		}
+	}()
+}
+
+// EditMode selects one of our own recent messages to edit
+func (c *ChatWindow) EditMode() {
+	c.SelectMode("edit", func(msg *model.Message) bool {
+		return msg.CanEdit(time.Now())
+	}, c.StartEdit)
+}
+
+// StartEdit puts the content of `msg` in the send panel, so that the next message we send
+// replaces it
+func (c *ChatWindow) StartEdit(msg *model.Message) {
+	conv, err := c.currentConversation()
+	if err != nil {
+		c.SetErrorStatus(err)
+		return
+	}
+	conv.ClearStaged()
+	conv.StageEdit(msg)
+	conv.StagedMessage = msg.Content
+	c.sendPanel.Update()
+	c.InsertMode()
+}
+
+// Edit sends `content` as the new version of one of our messages in the current conversation
+func (c *ChatWindow) Edit(msg *model.Message, content string) {
+	contact := c.currentContact
+	go func() {
+		if err := c.siggo.Edit(contact, msg, content); err != nil {
+			c.SetErrorStatus(fmt.Errorf("failed to edit message: %w", err))
+			// the edit is still staged, so put it back in the send panel
+			c.app.QueueUpdateDraw(func() {
+				if c.currentContact == contact {
+					c.sendPanel.Update()
+				}
+			})
+			return
+		}
+		log.Infof("edited message: %s to contact: %s", content, contact)
+	}()
+}
+
+// isLiveMessage filters out messages that were deleted for everyone, messages we haven't sent yet,
+// and entries that aren't messages at all, like calls
+func isLiveMessage(msg *model.Message) bool {
+	return !msg.IsDeleted && msg.SendState == "" && msg.Kind != model.SystemMessage
+}
+
+// isUnsent filters out everything but messages in the outbox
+func isUnsent(msg *model.Message) bool {
+	return msg.SendState == model.Queued || msg.SendState == model.Failed
+}
+
+// RetryMode selects a message we haven't managed to send, and tries again
+func (c *ChatWindow) RetryMode() {
+	c.SelectMode("retry", isUnsent, func(msg *model.Message) {
+		c.NormalMode()
+		go func() {
+			if err := c.siggo.Retry(msg); err != nil {
+				c.SetErrorStatus(fmt.Errorf("failed to send message: %w", err))
+			}
+		}()
+	})
+}
+
+// CancelMode selects a message we haven't managed to send, and gives up on it
+func (c *ChatWindow) CancelMode() {
+	c.SelectMode("cancel", isUnsent, func(msg *model.Message) {
+		c.NormalMode()
+		if err := c.siggo.Cancel(msg); err != nil {
+			c.SetErrorStatus(err)
+		}
+	})
+}
+
 // NormalMode enters normal mode
 func (c *ChatWindow) NormalMode() {
 	log.Debug("NORMAL MODE")
@@ -158,8 +298,7 @@ func (c *ChatWindow) getAttachments() []*model.Attachment {
 	}
 	// TODO: make siggo.Conversation keep a list of attachments
 	// so that we don't have to search for them like this
-	for _, ID := range conv.MessageOrder {
-		msg := conv.Messages[ID]
+	for _, msg := range conv.MessageList() {
 		if len(msg.Attachments) > 0 {
 			a = append(a, msg.Attachments...)
 		}
@@ -199,6 +338,38 @@ func (c *ChatWindow) ShowAttachInput() {
 	c.app.SetFocus(p)
 }
 
+// ShowReactInput opens a commandPanel to choose an emoji to react to `msg` with
+func (c *ChatWindow) ShowReactInput(msg *model.Message) {
+	c.HideCommandInput() // only one at a time
+	log.Debug("SHOWING REACT INPUT")
+	p := NewReactInput(c, msg)
+	c.commandPanel = p
+	c.SetRows(0, 3, 1)
+	c.AddItem(p, 2, 0, 1, 2, 0, 0, false)
+	c.app.SetFocus(p)
+}
+
+// React reacts to `msg` in the current conversation. An empty emoji removes our reaction.
+func (c *ChatWindow) React(msg *model.Message, emoji string) {
+	contact := c.currentContact
+	go func() {
+		if err := c.siggo.React(contact, msg, emoji); err != nil {
+			c.SetErrorStatus(fmt.Errorf("failed to react: %w", err))
+		}
+	}()
+}
+
+// ShowCommandLine opens a commandPanel to run a command
+func (c *ChatWindow) ShowCommandLine() {
+	c.HideCommandInput() // only one at a time
+	log.Debug("SHOWING COMMAND LINE")
+	p := NewCommandLine(c)
+	c.commandPanel = p
+	c.SetRows(0, 3, 1)
+	c.AddItem(p, 2, 0, 1, 2, 0, 0, false)
+	c.app.SetFocus(p)
+}
+
 // ShowFilterInput opens a commandPanel to filter the conversation
 func (c *ChatWindow) ShowFilterInput() {
 	c.HideCommandInput() // only one at a time
@@ -245,7 +416,7 @@ func (c *ChatWindow) SetStatus(statusMsg string) {
 // SetErrorStatus shows an error status in the status bar
 func (c *ChatWindow) SetErrorStatus(err error) {
 	log.Errorf("%s", err)
-	c.statusBar.SetText(fmt.Sprintf("🔥%s", err))
+	c.statusBar.SetText(fmt.Sprintf("🔥%s", signal.Describe(err)))
 	c.ShowStatusBar()
 }
 
@@ -276,7 +447,7 @@ func (c *ChatWindow) SetCurrentContact(contact *model.Contact) error {
 		return err
 	}
 	c.conversationPanel.Update(conv)
-	conv.CaughtUp()
+	c.siggo.CaughtUp(contact)
 	c.sendPanel.Clear()
 	c.sendPanel.Update()
 	c.conversationPanel.ScrollToEnd()
@@ -342,13 +513,20 @@ func (c *ChatWindow) ContactDown() {
 }
 
 // Compose opens an EDITOR to compose a command. If any text is saved in the buffer,
-// we send it as a message to the current conversation.
+// we send it as a message to the current conversation. If we are editing a message, the EDITOR
+// starts out with its text and what we save replaces it.
 func (c *ChatWindow) Compose() {
 	msg := ""
 	var err error
 
+	initial := ""
+	var editing *model.Message
+	if conv, convErr := c.currentConversation(); convErr == nil && conv.StagedEdit() != nil {
+		editing = conv.StagedEdit()
+		initial = c.sendPanel.GetText()
+	}
 	success := c.app.Suspend(func() {
-		msg, err = FancyCompose()
+		msg, err = FancyCompose(initial)
 	})
 	// need to sleep because there seems to be a race condition in tview
 	// https://github.com/rivo/tview/issues/244
@@ -361,10 +539,13 @@ func (c *ChatWindow) Compose() {
 		c.SetErrorStatus(err)
 		return
 	}
-	if msg != "" {
+	if msg != "" && editing != nil {
+		c.Edit(editing, emoji.Sprint(msg))
+		c.sendPanel.SetText("")
+		c.sendPanel.SetLabel("")
+	} else if msg != "" {
 		msg = emoji.Sprint(msg)
 		contact := c.currentContact
-		c.ShowTempSentMsg(msg)
 		go c.siggo.Send(msg, contact)
 		log.Infof("sending message: %s to contact: %s", msg, contact)
 	}
@@ -433,29 +614,60 @@ func (c *ChatWindow) FuzzyGoTo() {
 	}
 }
 
-// ShowTempSentMsg shows a temporary message when a message is sent but before delivery.
-// Only displayed for the second or two after a message is sent.
-func (c *ChatWindow) ShowTempSentMsg(msg string) {
-	tmpMsg := &model.Message{
-		Content:     msg,
-		From:        " ~ ",
-		Timestamp:   time.Now().Unix() * 1000,
-		IsDelivered: false,
-		IsRead:      false,
-		FromSelf:    true,
-	}
-	// write directly to conv panel but don't add to conversation
-	// no color since its from us
-	c.conversationPanel.Write([]byte(tmpMsg.String()))
-}
-
 // Quit shuts down gracefully
 func (c *ChatWindow) Quit() {
 	c.app.Stop()
-	c.siggo.Quit()
+	for _, account := range c.accounts {
+		account.Quit()
+	}
+	model.ClearRunning()
 	os.Exit(0)
 }
 
+// SwitchAccount switches to another one of our accounts
+func (c *ChatWindow) SwitchAccount(account *model.Siggo) {
+	log.Debugf("switching to account: %s", account.Account())
+	c.siggo = account
+	c.contactsPanel.siggo = account
+	c.sendPanel.siggo = account
+	c.currentContact = nil
+	if contacts := account.Contacts().SortedByIndex(); len(contacts) > 0 {
+		c.SetCurrentContact(contacts[0])
+	}
+	c.update()
+	c.SetStatus(fmt.Sprintf("account: %s", account.Account()))
+}
+
+// NextAccount switches to the next one of our accounts
+func (c *ChatWindow) NextAccount() {
+	for i, account := range c.accounts {
+		if account == c.siggo {
+			c.SwitchAccount(c.accounts[(i+1)%len(c.accounts)])
+			return
+		}
+	}
+}
+
+// renderAccounts shows our accounts and how many unread messages each of them has in the title
+// of the contact list, if we have more than one
+func (c *ChatWindow) renderAccounts() {
+	if len(c.accounts) < 2 || c.siggo.Config().HidePanelTitles {
+		return
+	}
+	names := make([]string, 0, len(c.accounts))
+	for _, account := range c.accounts {
+		name := account.Account().String()
+		if unread := account.UnreadCount(); unread > 0 {
+			name = fmt.Sprintf("%s (%d)", name, unread)
+		}
+		if account == c.siggo {
+			name = fmt.Sprintf("[::u]%s[::-]", name)
+		}
+		names = append(names, name)
+	}
+	c.contactsPanel.SetTitle(strings.Join(names, " | "))
+}
+
 func (c *ChatWindow) update() {
 	convs := c.siggo.Conversations()
 	if convs != nil && len(convs) > 0 {
@@ -468,6 +680,7 @@ func (c *ChatWindow) update() {
 			}
 		}
 		c.contactsPanel.Render()
+		c.renderAccounts()
 		currentConv, ok := convs[c.currentContact]
 		if ok {
 			c.conversationPanel.Update(currentConv)
@@ -491,14 +704,18 @@ func NewStatusBar(parent *ChatWindow) *StatusBar {
 	return sb
 }
 
-func NewChatWindow(siggo *model.Siggo, app *tview.Application) *ChatWindow {
+// NewChatWindow creates the main window for one or more accounts. The first account is shown
+// first.
+func NewChatWindow(accounts []*model.Siggo, app *tview.Application) *ChatWindow {
 	layout := tview.NewGrid().
 		SetRows(0, 3).
 		SetColumns(20, 0)
+	siggo := accounts[0]
 	w := &ChatWindow{
-		Grid:  layout,
-		siggo: siggo,
-		app:   app,
+		Grid:     layout,
+		siggo:    siggo,
+		accounts: accounts,
+		app:      app,
 	}
 
 	w.conversationPanel = NewConversationPanel(siggo)
@@ -557,6 +774,27 @@ func NewChatWindow(siggo *model.Siggo, app *tview.Application) *ChatWindow {
 			case 110: // n
 				w.NextUnreadMessage()
 				return nil
+			case 114: // r
+				w.ReactMode()
+				return nil
+			case 113: // q
+				w.ReplyMode()
+				return nil
+			case 68: // D
+				w.DeleteMode()
+				return nil
+			case 58: // :
+				w.ShowCommandLine()
+				return nil
+			case 119: // w
+				w.NextAccount()
+				return nil
+			case 83: // S
+				w.SafetyMode()
+				return nil
+			case 69: // E
+				w.EditMode()
+				return nil
 			}
 			// pass some events on to the conversation panel
 		case tcell.KeyCtrlQ:
@@ -640,21 +878,62 @@ func NewChatWindow(siggo *model.Siggo, app *tview.Application) *ChatWindow {
 	// update gui when events happen in siggo
 	w.update()
 	w.conversationPanel.ScrollToEnd()
-	siggo.NewInfo = func(conv *model.Conversation) {
-		app.QueueUpdateDraw(func() {
-			w.update()
-		})
+	for _, account := range accounts {
+		account := account
+		account.NewInfo = func(conv *model.Conversation) {
+			app.QueueUpdateDraw(func() {
+				if account != w.siggo {
+					// all we show of the other accounts is how much they have unread
+					w.renderAccounts()
+					return
+				}
+				w.update()
+			})
+		}
+		account.ErrorEvent = w.SetErrorStatus
+		account.StateChange = w.connectionStatus(account)
 	}
-	siggo.ErrorEvent = w.SetErrorStatus
 	return w
 }
 
-// FancyCompose opens up EDITOR and composes a big fancy message.
-func FancyCompose() (string, error) {
+// connectionStatus returns a callback that shows the state of an account's connection to
+// signal-cli in the status bar. We keep quiet about the first connection, since that is what
+// everybody expects to happen.
+func (c *ChatWindow) connectionStatus(account *model.Siggo) func(signal.ConnState) {
+	connectedBefore := false
+	return func(state signal.ConnState) {
+		switch {
+		case state == signal.ConnStarting:
+			return
+		case state == signal.ConnConnected && !connectedBefore:
+			connectedBefore = true
+			return
+		}
+		status := fmt.Sprintf("📡signal-cli %s", state)
+		if len(c.accounts) > 1 {
+			status = fmt.Sprintf("%s: %s", account.Account(), status)
+		}
+		c.app.QueueUpdateDraw(func() {
+			if state == signal.ConnFailed {
+				c.SetErrorStatus(fmt.Errorf("%s", status))
+			} else {
+				c.SetStatus(status)
+			}
+		})
+	}
+}
+
+// FancyCompose opens up EDITOR and composes a big fancy message, starting with `initial`.
+func FancyCompose(initial string) (string, error) {
 	tmpFile, err := ioutil.TempFile(os.TempDir(), "siggo-compose-")
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp file for compose: %v", err)
 	}
+	_, err = tmpFile.WriteString(initial)
+	tmpFile.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to write temp file for compose: %v", err)
+	}
 	editor := os.Getenv("EDITOR")
 	if editor == "" {
 		return "", fmt.Errorf("cannot compose: no $EDITOR set in environment")
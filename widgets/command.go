@@ -0,0 +1,404 @@
+package widgets
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/derricw/siggo/model"
+	"github.com/derricw/siggo/signal"
+)
+
+// Command is something that can be run from the command line, like `:timer 1h`
+type Command struct {
+	Usage string
+	Help  string
+	Run   func(c *ChatWindow, args []string) error
+}
+
+// commands are all of the commands available from the command line, by name
+var commands = map[string]*Command{
+	"timer": {
+		Usage: "timer <30s|5m|1h|1d|1w|off>",
+		Help:  "show or set the disappearing message timer for the current conversation",
+		Run: func(c *ChatWindow, args []string) error {
+			conv, err := c.currentConversation()
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				c.SetStatus(fmt.Sprintf("disappearing messages: %s", model.FormatTimer(conv.ExpiresIn)))
+				return nil
+			}
+			seconds, err := model.ParseTimer(args[0])
+			if err != nil {
+				return err
+			}
+			contact := c.currentContact
+			go func() {
+				if err := c.siggo.SetExpiration(contact, seconds); err != nil {
+					c.SetErrorStatus(fmt.Errorf("failed to set timer: %w", err))
+					return
+				}
+				c.SetStatus(fmt.Sprintf("disappearing messages: %s", model.FormatTimer(seconds)))
+			}()
+			return nil
+		},
+	},
+}
+
+// currentGroup returns the current contact if it is a group
+func (c *ChatWindow) currentGroup() (*model.Contact, error) {
+	if c.currentContact == nil || !c.currentContact.IsGroup() {
+		return nil, fmt.Errorf("not a group")
+	}
+	return c.currentContact, nil
+}
+
+// updateGroupCommand is a command that makes some change to the current group. `makeUpdate`
+// gets the arguments joined back together.
+func updateGroupCommand(usage, help string, makeUpdate func(c *ChatWindow, arg string) (*signal.GroupUpdate, error)) *Command {
+	return &Command{
+		Usage: usage,
+		Help:  help,
+		Run: func(c *ChatWindow, args []string) error {
+			group, err := c.currentGroup()
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("missing argument")
+			}
+			update, err := makeUpdate(c, strings.Join(args, " "))
+			if err != nil {
+				return err
+			}
+			go func() {
+				if err := c.siggo.UpdateGroup(group, update); err != nil {
+					c.SetErrorStatus(fmt.Errorf("failed to update group: %w", err))
+					return
+				}
+				c.SetStatus(fmt.Sprintf("updated group: %s", group))
+			}()
+			return nil
+		},
+	}
+}
+
+// profileUpdate makes an update to one field of our profile
+func profileUpdate(field, value string) (*signal.ProfileUpdate, error) {
+	switch field {
+	case "name":
+		names := strings.SplitN(value, ",", 2)
+		update := &signal.ProfileUpdate{GivenName: strings.TrimSpace(names[0])}
+		if len(names) > 1 {
+			update.FamilyName = strings.TrimSpace(names[1])
+		}
+		return update, nil
+	case "about":
+		return &signal.ProfileUpdate{About: value}, nil
+	case "emoji":
+		return &signal.ProfileUpdate{AboutEmoji: value}, nil
+	case "avatar":
+		if value == "none" {
+			return &signal.ProfileUpdate{RemoveAvatar: true}, nil
+		}
+		return &signal.ProfileUpdate{Avatar: value}, nil
+	}
+	return nil, fmt.Errorf("unknown profile field: %s", field)
+}
+
+// members resolves a comma-separated list of names or numbers
+func (c *ChatWindow) members(list string) ([]model.PhoneNumber, error) {
+	numbers, err := c.siggo.Numbers(strings.Split(list, ","))
+	if err != nil {
+		return nil, err
+	}
+	if len(numbers) == 0 {
+		return nil, fmt.Errorf("no members")
+	}
+	return numbers, nil
+}
+
+func init() {
+	commands["newgroup"] = &Command{
+		Usage: "newgroup <name>[: member, member...]",
+		Help:  "create a group",
+		Run: func(c *ChatWindow, args []string) error {
+			line := strings.Join(args, " ")
+			if line == "" {
+				return fmt.Errorf("missing name")
+			}
+			name, memberList := line, ""
+			if i := strings.Index(line, ":"); i >= 0 {
+				name, memberList = strings.TrimSpace(line[:i]), line[i+1:]
+			}
+			members, err := c.siggo.Numbers(strings.Split(memberList, ","))
+			if err != nil {
+				return err
+			}
+			go func() {
+				group, err := c.siggo.CreateGroup(name, members)
+				if err != nil {
+					c.SetErrorStatus(fmt.Errorf("failed to create group: %w", err))
+					return
+				}
+				c.app.QueueUpdateDraw(func() {
+					c.SetCurrentContact(group)
+				})
+			}()
+			return nil
+		},
+	}
+	commands["rename"] = updateGroupCommand("rename <name>", "rename the current group",
+		func(c *ChatWindow, arg string) (*signal.GroupUpdate, error) {
+			return &signal.GroupUpdate{Name: arg}, nil
+		})
+	commands["describe"] = updateGroupCommand("describe <description>", "set the current group's description",
+		func(c *ChatWindow, arg string) (*signal.GroupUpdate, error) {
+			return &signal.GroupUpdate{Description: arg}, nil
+		})
+	commands["avatar"] = updateGroupCommand("avatar <image>", "set the current group's avatar",
+		func(c *ChatWindow, arg string) (*signal.GroupUpdate, error) {
+			return &signal.GroupUpdate{Avatar: arg}, nil
+		})
+	commands["add"] = updateGroupCommand("add <member, member...>", "add members to the current group",
+		func(c *ChatWindow, arg string) (*signal.GroupUpdate, error) {
+			members, err := c.members(arg)
+			return &signal.GroupUpdate{AddMembers: members}, err
+		})
+	commands["remove"] = updateGroupCommand("remove <member, member...>", "remove members from the current group",
+		func(c *ChatWindow, arg string) (*signal.GroupUpdate, error) {
+			members, err := c.members(arg)
+			return &signal.GroupUpdate{RemoveMembers: members}, err
+		})
+	commands["admin"] = updateGroupCommand("admin <member, member...>", "make members admins of the current group",
+		func(c *ChatWindow, arg string) (*signal.GroupUpdate, error) {
+			members, err := c.members(arg)
+			return &signal.GroupUpdate{AddAdmins: members}, err
+		})
+	commands["unadmin"] = updateGroupCommand("unadmin <member, member...>", "take admin away from members of the current group",
+		func(c *ChatWindow, arg string) (*signal.GroupUpdate, error) {
+			members, err := c.members(arg)
+			return &signal.GroupUpdate{RemoveAdmins: members}, err
+		})
+	commands["leave"] = &Command{
+		Usage: "leave",
+		Help:  "leave the current group",
+		Run: func(c *ChatWindow, args []string) error {
+			group, err := c.currentGroup()
+			if err != nil {
+				return err
+			}
+			go func() {
+				if err := c.siggo.LeaveGroup(group); err != nil {
+					c.SetErrorStatus(fmt.Errorf("failed to leave group: %w", err))
+					return
+				}
+				c.app.QueueUpdateDraw(func() {
+					if contacts := c.siggo.Contacts().SortedByIndex(); len(contacts) > 0 {
+						c.SetCurrentContact(contacts[0])
+					}
+					c.SetStatus(fmt.Sprintf("left group: %s", group))
+				})
+			}()
+			return nil
+		},
+	}
+	commands["name"] = &Command{
+		Usage: "name <name>",
+		Help:  "rename the current contact",
+		Run: func(c *ChatWindow, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("missing name")
+			}
+			contact, name := c.currentContact, strings.Join(args, " ")
+			if contact == nil {
+				return fmt.Errorf("no contact selected")
+			}
+			go func() {
+				if err := c.siggo.RenameContact(contact, name); err != nil {
+					c.SetErrorStatus(fmt.Errorf("failed to rename contact: %w", err))
+				}
+			}()
+			return nil
+		},
+	}
+	commands["block"] = &Command{
+		Usage: "block",
+		Help:  "block the current contact or group",
+		Run: func(c *ChatWindow, args []string) error {
+			contact := c.currentContact
+			if contact == nil {
+				return fmt.Errorf("no contact selected")
+			}
+			go func() {
+				if err := c.siggo.Block(contact); err != nil {
+					c.SetErrorStatus(fmt.Errorf("failed to block: %w", err))
+					return
+				}
+				c.SetStatus(fmt.Sprintf("blocked: %s", contact))
+			}()
+			return nil
+		},
+	}
+	commands["unblock"] = &Command{
+		Usage: "unblock",
+		Help:  "unblock the current contact or group",
+		Run: func(c *ChatWindow, args []string) error {
+			contact := c.currentContact
+			if contact == nil {
+				return fmt.Errorf("no contact selected")
+			}
+			go func() {
+				if err := c.siggo.Unblock(contact); err != nil {
+					c.SetErrorStatus(fmt.Errorf("failed to unblock: %w", err))
+					return
+				}
+				c.SetStatus(fmt.Sprintf("unblocked: %s", contact))
+			}()
+			return nil
+		},
+	}
+	commands["blocked"] = &Command{
+		Usage: "blocked",
+		Help:  "show or hide blocked contacts and groups",
+		Run: func(c *ChatWindow, args []string) error {
+			if c.contactsPanel.ToggleBlocked() {
+				c.SetStatus("showing blocked contacts")
+			} else {
+				c.SetStatus("hiding blocked contacts")
+			}
+			return nil
+		},
+	}
+	commands["forget"] = &Command{
+		Usage: "forget",
+		Help:  "remove the current contact",
+		Run: func(c *ChatWindow, args []string) error {
+			contact := c.currentContact
+			if contact == nil || contact.IsGroup() {
+				return fmt.Errorf("not a contact")
+			}
+			go func() {
+				if err := c.siggo.RemoveContact(contact); err != nil {
+					c.SetErrorStatus(fmt.Errorf("failed to remove contact: %w", err))
+					return
+				}
+				c.app.QueueUpdateDraw(func() {
+					if contacts := c.siggo.Contacts().SortedByIndex(); len(contacts) > 0 {
+						c.SetCurrentContact(contacts[0])
+					}
+					c.SetStatus(fmt.Sprintf("removed contact: %s", contact))
+				})
+			}()
+			return nil
+		},
+	}
+	commands["profile"] = &Command{
+		Usage: "profile <name|about|emoji|avatar> <value>",
+		Help:  "update your own profile. Names are \"given name, family name\", avatar \"none\" removes it",
+		Run: func(c *ChatWindow, args []string) error {
+			if len(args) < 2 {
+				return fmt.Errorf("usage: profile <name|about|emoji|avatar> <value>")
+			}
+			update, err := profileUpdate(args[0], strings.Join(args[1:], " "))
+			if err != nil {
+				return err
+			}
+			go func() {
+				if err := c.siggo.UpdateProfile(update); err != nil {
+					c.SetErrorStatus(fmt.Errorf("failed to update profile: %w", err))
+					return
+				}
+				c.SetStatus(fmt.Sprintf("updated profile %s", args[0]))
+			}()
+			return nil
+		},
+	}
+	commands["retry"] = &Command{
+		Usage: "retry",
+		Help:  "pick a message that hasn't been sent and try sending it again",
+		Run: func(c *ChatWindow, args []string) error {
+			c.RetryMode()
+			return nil
+		},
+	}
+	commands["cancel"] = &Command{
+		Usage: "cancel",
+		Help:  "pick a message that hasn't been sent and give up on it",
+		Run: func(c *ChatWindow, args []string) error {
+			c.CancelMode()
+			return nil
+		},
+	}
+
+	// help lists the other commands, so it can't be part of the map literal
+	commands["help"] = &Command{
+		Usage: "help [command]",
+		Help:  "list commands, or describe one",
+		Run: func(c *ChatWindow, args []string) error {
+			if len(args) > 0 {
+				cmd, ok := commands[args[0]]
+				if !ok {
+					return fmt.Errorf("unknown command: %s", args[0])
+				}
+				c.SetStatus(fmt.Sprintf(":%s - %s", cmd.Usage, cmd.Help))
+				return nil
+			}
+			names := make([]string, 0, len(commands))
+			for name := range commands {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			c.SetStatus(fmt.Sprintf("commands: %s", strings.Join(names, ", ")))
+			return nil
+		},
+	}
+}
+
+// RunCommand runs a line from the command line
+func (c *ChatWindow) RunCommand(line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+	cmd, ok := commands[fields[0]]
+	if !ok {
+		c.SetErrorStatus(fmt.Errorf("unknown command: %s (try :help)", fields[0]))
+		return
+	}
+	if err := cmd.Run(c, fields[1:]); err != nil {
+		c.SetErrorStatus(fmt.Errorf("%s: %v (usage: %s)", fields[0], err, cmd.Usage))
+	}
+}
+
+// NewCommandLine is a command input that runs commands, like `:timer 1h`
+func NewCommandLine(parent *ChatWindow) *CommandInput {
+	ci := &CommandInput{
+		InputField: tview.NewInputField(),
+		parent:     parent,
+	}
+	ci.SetLabel(":")
+	ci.SetFieldBackgroundColor(tview.Styles.PrimitiveBackgroundColor)
+	ci.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Setup keys
+		log.Debugf("Key Event <COMMAND>: %v mods: %v rune: %v", event.Key(), event.Modifiers(), event.Rune())
+		switch event.Key() {
+		case tcell.KeyESC:
+			ci.parent.HideCommandInput()
+			return nil
+		case tcell.KeyEnter:
+			line := ci.GetText()
+			ci.parent.HideCommandInput()
+			ci.parent.RunCommand(line)
+			return nil
+		}
+		return event
+	})
+	return ci
+}
@@ -10,12 +10,40 @@ import (
 
 const DraftMarker = "~"
 
+// BlockedMarker marks blocked contacts, when they are shown
+const BlockedMarker = "⊘"
+
 type ContactListPanel struct {
 	*tview.TextView
 	siggo          *model.Siggo
 	parent         *ChatWindow
 	sortedContacts []*model.Contact
 	currentIndex   int
+	// showBlocked shows blocked contacts and groups. The current contact is always shown.
+	showBlocked bool
+}
+
+// ToggleBlocked shows or hides blocked contacts, and returns whether they are shown
+func (cl *ContactListPanel) ToggleBlocked() bool {
+	cl.showBlocked = !cl.showBlocked
+	cl.Render()
+	cl.GotoContact(cl.parent.currentContact)
+	return cl.showBlocked
+}
+
+// visible returns the contacts we should show, in order
+func (cl *ContactListPanel) visible() []*model.Contact {
+	sorted := cl.siggo.Contacts().SortedByIndex()
+	if cl.showBlocked {
+		return sorted
+	}
+	visible := make([]*model.Contact, 0, len(sorted))
+	for _, c := range sorted {
+		if !c.IsBlocked() || c == cl.parent.currentContact {
+			visible = append(visible, c)
+		}
+	}
+	return visible
 }
 
 func (cl *ContactListPanel) Next() *model.Contact {
@@ -56,8 +84,14 @@ func (cl *ContactListPanel) Render() {
 	log.Debug("updating contact panel...")
 	// this is dumb, we re-sort every update
 	// TODO: don't
-	sorted := cl.siggo.Contacts().SortedByIndex()
+	sorted := cl.visible()
 	convs := cl.siggo.Conversations()
+	// hidden blocked contacts can shift things around, so find our place again
+	for i, c := range sorted {
+		if c == cl.parent.currentContact {
+			cl.currentIndex = i
+		}
+	}
 	log.Debugf("sorted contacts: %v", sorted)
 	for i, c := range sorted {
 		id := c.String()
@@ -73,6 +107,9 @@ func (cl *ContactListPanel) Render() {
 		if convs[c].HasStagedData() {
 			line += DraftMarker
 		}
+		if c.IsBlocked() {
+			line += BlockedMarker
+		}
 		data += fmt.Sprintf("%s\n", line)
 	}
 	cl.sortedContacts = sorted
@@ -82,9 +119,10 @@ func (cl *ContactListPanel) Render() {
 // NewContactListPanel creates a new contact list widget
 func NewContactListPanel(parent *ChatWindow, siggo *model.Siggo) *ContactListPanel {
 	c := &ContactListPanel{
-		TextView: tview.NewTextView(),
-		siggo:    siggo,
-		parent:   parent,
+		TextView:    tview.NewTextView(),
+		siggo:       siggo,
+		parent:      parent,
+		showBlocked: siggo.Config().ShowBlocked,
 	}
 	c.SetDynamicColors(true)
 	c.SetTitle("contacts")
@@ -21,11 +21,17 @@ func (p *ConversationPanel) Update(conv *model.Conversation) {
 	p.Clear()
 	p.SetText(conv.Filter(p.filter))
 	if !p.hideTitle {
+		title := conv.Contact.String()
 		if !p.hidePhoneNumber {
-			p.SetTitle(fmt.Sprintf("%s <%s>", conv.Contact.String(), conv.Contact.Number))
-		} else {
-			p.SetTitle(conv.Contact.String())
+			title = fmt.Sprintf("%s <%s>", conv.Contact.String(), conv.Contact.Number)
 		}
+		if timer := conv.TimerString(); timer != "" {
+			title = fmt.Sprintf("%s ⏱ %s", title, timer)
+		}
+		if typing := conv.TypingString(); typing != "" {
+			title = fmt.Sprintf("%s - %s", title, typing)
+		}
+		p.SetTitle(title)
 	}
 	conv.HasNewMessage = false
 }
@@ -0,0 +1,151 @@
+package widgets
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/derricw/siggo/model"
+)
+
+// maxSelectLength is how much of a message (in runes) we show when selecting it
+const maxSelectLength = 80
+
+// MessageSelect is a widget that lets us pick a message from the current conversation, for
+// example to react to it.
+type MessageSelect struct {
+	*tview.List
+	parent   *ChatWindow
+	messages []*model.Message
+	onSelect func(*model.Message)
+}
+
+func (ms *MessageSelect) Close() {
+	ms.parent.Grid.RemoveItem(ms)
+	ms.parent.ShowConversation()
+	ms.parent.FocusMe()
+}
+
+// init populates the list with messages from the current conversation that pass `filter`
+func (ms *MessageSelect) init(filter func(*model.Message) bool) {
+	ms.Clear()
+	conv, err := ms.parent.currentConversation()
+	if err != nil {
+		return
+	}
+	ms.messages = make([]*model.Message, 0)
+	for _, msg := range conv.MessageList() {
+		if filter != nil && !filter(msg) {
+			continue
+		}
+		ms.messages = append(ms.messages, msg)
+		ms.AddItem(selectText(msg), "", 0, nil)
+	}
+}
+
+// selectText renders a message as a single line
+func selectText(msg *model.Message) string {
+	from := model.SelfName
+	if !msg.FromSelf && msg.FromContact != nil {
+		from = msg.FromContact.String()
+	}
+	content := strings.Join(strings.Fields(msg.Content), " ")
+	if r := []rune(content); len(r) > maxSelectLength {
+		content = string(r[:maxSelectLength]) + "…"
+	}
+	ts := time.Unix(0, msg.Timestamp*1000000).Format("2006-01-02 15:04:05")
+	return fmt.Sprintf(" %s | %s: %s", ts, from, content)
+}
+
+func (ms *MessageSelect) Previous() {
+	current := ms.GetCurrentItem()
+	ms.SetCurrentItem(current - 1)
+}
+
+func (ms *MessageSelect) Next() {
+	current := ms.GetCurrentItem()
+	ms.SetCurrentItem(current + 1)
+}
+
+// Selected returns the selected message, or nil if there are none
+func (ms *MessageSelect) Selected() *model.Message {
+	nmessages := len(ms.messages)
+	selected := ms.GetCurrentItem()
+	if nmessages == 0 || selected >= nmessages {
+		return nil
+	}
+	return ms.messages[selected]
+}
+
+// SelectCurrent closes the widget and calls `onSelect` with the selected message
+func (ms *MessageSelect) SelectCurrent() {
+	ms.Close()
+	msg := ms.Selected()
+	if msg == nil {
+		ms.parent.NormalMode()
+		return
+	}
+	ms.onSelect(msg)
+}
+
+// NewMessageSelect creates a widget to select a message from the current conversation. Only
+// messages that pass `filter` are shown (all of them if it is nil). `onSelect` is called with
+// whichever message is chosen.
+func NewMessageSelect(parent *ChatWindow, title string, filter func(*model.Message) bool, onSelect func(*model.Message)) *MessageSelect {
+	ms := &MessageSelect{
+		List:     tview.NewList(),
+		parent:   parent,
+		onSelect: onSelect,
+	}
+	inputHandler := ms.List.InputHandler()
+	ms.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Setup keys
+		log.Debugf("Key Event <SELECT>: %v mods: %v rune: %v", event.Key(), event.Modifiers(), event.Rune())
+		switch event.Key() {
+		case tcell.KeyESC:
+			ms.Close()
+			ms.parent.NormalMode()
+			return nil
+		case tcell.KeyPgUp:
+			inputHandler(event, func(p tview.Primitive) {})
+			return nil
+		case tcell.KeyPgDn:
+			inputHandler(event, func(p tview.Primitive) {})
+			return nil
+		case tcell.KeyEnd:
+			inputHandler(event, func(p tview.Primitive) {})
+			return nil
+		case tcell.KeyHome:
+			inputHandler(event, func(p tview.Primitive) {})
+			return nil
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case 106: // j
+				ms.Next()
+				return nil
+			case 107: // k
+				ms.Previous()
+				return nil
+			}
+		case tcell.KeyEnter:
+			ms.SelectCurrent()
+			return nil
+		}
+		return event
+	})
+
+	ms.SetHighlightFullLine(true)
+	ms.ShowSecondaryText(false)
+	ms.SetBorder(true)
+	ms.SetTitle(fmt.Sprintf("%s: %s", title, parent.currentContactName()))
+	ms.SetTitleAlign(0)
+	ms.init(filter)
+	// most recent message first
+	ms.SetCurrentItem(-1)
+
+	return ms
+}
@@ -2,6 +2,7 @@ package widgets
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/gdamore/tcell"
 	"github.com/rivo/tview"
@@ -74,16 +75,21 @@ func (oi *OpenInput) OpenSelected() {
 
 // OpenAttachment opens a `*signal.Attachment`
 func (oi *OpenInput) OpenAttachment(attachment *model.Attachment) {
-	path, err := attachment.Path()
+	path, done, err := oi.parent.siggo.ViewAttachment(oi.parent.currentContact, attachment)
 	if err != nil {
-		oi.parent.SetErrorStatus(fmt.Errorf("📎failed to find attachment: %v", err))
+		oi.parent.SetErrorStatus(fmt.Errorf("📎failed to open attachment: %v", err))
 		return
 	}
-	oi.OpenPath(path)
+	oi.openPath(path, done)
 }
 
 // OpenAttachment opens any file @ path using xdg-open
 func (oi *OpenInput) OpenPath(path string) {
+	oi.openPath(path, func() {})
+}
+
+// openPath opens a file and calls `done` once the viewer has had time to load it
+func (oi *OpenInput) openPath(path string, done func()) {
 	go func() {
 		err := open.Run(path)
 		if err != nil {
@@ -91,9 +97,15 @@ func (oi *OpenInput) OpenPath(path string) {
 		} else {
 			oi.parent.SetStatus(fmt.Sprintf("📎%s", path))
 		}
+		// xdg-open returns as soon as the viewer starts, so give it a moment before we delete
+		// anything out from under it
+		time.AfterFunc(viewerGrace, done)
 	}()
 }
 
+// viewerGrace is how long we give a viewer to load view-once media before we delete it
+const viewerGrace = 10 * time.Second
+
 func NewOpenInput(parent *ChatWindow) *OpenInput {
 	oi := &OpenInput{
 		List:   tview.NewList(),
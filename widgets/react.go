@@ -0,0 +1,46 @@
+package widgets
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell"
+	"github.com/kyokomi/emoji"
+	"github.com/rivo/tview"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/derricw/siggo/model"
+)
+
+// NewReactInput is a command input that reacts to a message with an emoji. Emoji can be typed
+// with colons, like `:thumbsup:`. Leaving it empty removes our reaction.
+func NewReactInput(parent *ChatWindow, msg *model.Message) *CommandInput {
+	ci := &CommandInput{
+		InputField: tview.NewInputField(),
+		parent:     parent,
+	}
+	ci.SetLabel("react: ")
+	ci.SetFieldBackgroundColor(tview.Styles.PrimitiveBackgroundColor)
+	ci.SetChangedFunc(func(input string) {
+		if strings.HasSuffix(input, ":") {
+			if emojified := emoji.Sprint(input); emojified != input {
+				ci.SetText(emojified)
+			}
+		}
+	})
+	ci.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Setup keys
+		log.Debugf("Key Event <REACT>: %v mods: %v rune: %v", event.Key(), event.Modifiers(), event.Rune())
+		switch event.Key() {
+		case tcell.KeyESC:
+			ci.parent.HideCommandInput()
+			return nil
+		case tcell.KeyEnter:
+			reaction := strings.TrimSpace(emoji.Sprint(ci.GetText()))
+			ci.parent.HideCommandInput()
+			ci.parent.React(msg, reaction)
+			return nil
+		}
+		return event
+	})
+	return ci
+}
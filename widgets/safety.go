@@ -0,0 +1,159 @@
+package widgets
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/derricw/siggo/model"
+	"github.com/derricw/siggo/signal"
+)
+
+// trustColors are the colors we show each trust level in
+var trustColors = map[string]string{
+	signal.TrustedVerified:   "green",
+	signal.TrustedUnverified: "yellow",
+	signal.Untrusted:         "red",
+}
+
+// SafetyPanel shows the safety numbers for the current contact and lets us verify them
+type SafetyPanel struct {
+	*tview.TextView
+	parent  *ChatWindow
+	contact *model.Contact
+	// latest is the identity key the contact is using now
+	latest *signal.Identity
+}
+
+func (sp *SafetyPanel) Close() {
+	sp.parent.Grid.RemoveItem(sp)
+	sp.parent.ShowConversation()
+	sp.parent.NormalMode()
+}
+
+// Load fetches the contact's identity keys from signal-cli
+func (sp *SafetyPanel) Load() {
+	sp.SetText("loading...")
+	go func() {
+		identities, err := sp.parent.siggo.Identities(sp.contact)
+		sp.parent.app.QueueUpdateDraw(func() {
+			if err != nil {
+				sp.SetText("")
+				sp.parent.SetErrorStatus(fmt.Errorf("failed to list identities: %w", err))
+				return
+			}
+			sp.render(identities)
+		})
+	}()
+}
+
+// render shows the key the contact is using now, then any older ones
+func (sp *SafetyPanel) render(identities []*signal.Identity) {
+	sp.latest = nil
+	var b strings.Builder
+	if len(identities) == 0 {
+		b.WriteString("\n no identity keys yet. We get one when we first message them.\n")
+	}
+	for _, id := range identities {
+		if sp.latest == nil || id.AddedTimestamp > sp.latest.AddedTimestamp {
+			sp.latest = id
+		}
+	}
+	if sp.latest != nil {
+		writeIdentity(&b, sp.latest)
+	}
+	for _, id := range identities {
+		if id == sp.latest {
+			continue
+		}
+		b.WriteString("\n [::d]older key:[::-]\n")
+		writeIdentity(&b, id)
+	}
+	b.WriteString("\n [::d]v: compared with them, mark verified | a: trust all keys without verifying | esc: close[::-]\n")
+	sp.SetText(b.String())
+}
+
+// writeIdentity writes the safety number four groups to a line, like signal shows it
+func writeIdentity(b *strings.Builder, id *signal.Identity) {
+	color, ok := trustColors[id.TrustLevel]
+	if !ok {
+		color = "white"
+	}
+	added := time.Unix(0, id.AddedTimestamp*1000000).Format("2006-01-02")
+	fmt.Fprintf(b, "\n [%s]%s[-] (added %s)\n\n", color, id.TrustText(), added)
+	groups := id.SafetyNumberGroups()
+	for i := 0; i < len(groups); i += 4 {
+		end := i + 4
+		if end > len(groups) {
+			end = len(groups)
+		}
+		fmt.Fprintf(b, "   %s\n", strings.Join(groups[i:end], "  "))
+	}
+}
+
+// Trust verifies the contact's current key, or trusts all of their keys if `all` is true
+func (sp *SafetyPanel) Trust(all bool) {
+	safetyNumber := ""
+	if !all {
+		if sp.latest == nil {
+			return
+		}
+		safetyNumber = sp.latest.SafetyNumber
+	}
+	contact := sp.contact
+	go func() {
+		if err := sp.parent.siggo.Trust(contact, safetyNumber); err != nil {
+			sp.parent.SetErrorStatus(fmt.Errorf("failed to trust: %w", err))
+			return
+		}
+		if all {
+			sp.parent.SetStatus(fmt.Sprintf("trusted: %s", contact))
+		} else {
+			sp.parent.SetStatus(fmt.Sprintf("verified: %s", contact))
+		}
+		sp.parent.app.QueueUpdateDraw(sp.Load)
+	}()
+}
+
+// NewSafetyPanel creates a panel showing the safety numbers of the current contact
+func NewSafetyPanel(parent *ChatWindow) *SafetyPanel {
+	sp := &SafetyPanel{
+		TextView: tview.NewTextView(),
+		parent:   parent,
+		contact:  parent.currentContact,
+	}
+	sp.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Setup keys
+		log.Debugf("Key Event <SAFETY>: %v mods: %v rune: %v", event.Key(), event.Modifiers(), event.Rune())
+		switch event.Key() {
+		case tcell.KeyESC:
+			sp.Close()
+			return nil
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case 113: // q
+				sp.Close()
+				return nil
+			case 118: // v
+				sp.Trust(false)
+				return nil
+			case 97: // a
+				sp.Trust(true)
+				return nil
+			}
+		}
+		return event
+	})
+
+	sp.SetDynamicColors(true)
+	sp.SetBorder(true)
+	sp.SetTitle(fmt.Sprintf("safety numbers: %s", parent.currentContactName()))
+	sp.SetTitleAlign(0)
+	sp.Load()
+
+	return sp
+}
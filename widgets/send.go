@@ -2,6 +2,7 @@ package widgets
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/derricw/siggo/model"
@@ -15,6 +16,8 @@ type SendPanel struct {
 	*tview.InputField
 	parent *ChatWindow
 	siggo  *model.Siggo
+	// completing is set while the mention drop-down is open, so that Enter and ESC go to it
+	completing bool
 }
 
 func (s *SendPanel) Send() {
@@ -23,9 +26,12 @@ func (s *SendPanel) Send() {
 	}
 	msg := s.GetText()
 	contact := s.parent.currentContact
-	s.parent.ShowTempSentMsg(msg)
-	go s.siggo.Send(msg, contact)
-	log.Infof("sent message: %s to contact: %s", msg, contact)
+	if conv, err := s.parent.currentConversation(); err == nil && conv.StagedEdit() != nil {
+		s.parent.Edit(conv.StagedEdit(), msg)
+	} else {
+		go s.siggo.Send(msg, contact)
+		log.Infof("sent message: %s to contact: %s", msg, contact)
+	}
 	s.SetText("")
 	s.SetLabel("")
 }
@@ -37,6 +43,8 @@ func (s *SendPanel) Clear() {
 		return
 	}
 	conv.ClearAttachments()
+	conv.ClearQuote()
+	conv.ClearEdit()
 	s.Update()
 }
 
@@ -54,25 +62,74 @@ func (s *SendPanel) isDataStaged() bool {
 }
 
 func (s *SendPanel) Defocus() {
+	s.typing(false)
 	s.parent.NormalMode()
 }
 
+// typing tells the current contact whether we are typing
+func (s *SendPanel) typing(typing bool) {
+	if s.parent.currentContact == nil {
+		return
+	}
+	s.siggo.Typing(s.parent.currentContact, typing)
+}
+
+// onChanged handles any change to the input
+func (s *SendPanel) onChanged(input string) {
+	s.emojify(input)
+	// the text also changes when we switch conversations, so only count it as typing if we
+	// are actually in the input field
+	if s.HasFocus() {
+		s.typing(input != "")
+	}
+}
+
 func (s *SendPanel) Update() {
 	conv, err := s.parent.currentConversation()
 	if err != nil {
 		return
 	}
+	label := ""
+	if conv.StagedEdit() != nil {
+		label += "✎ "
+	}
+	if conv.StagedQuote() != nil {
+		label += "↪ "
+	}
 	nAttachments := conv.NumAttachments()
 	if nAttachments > 0 {
-		s.SetLabel(fmt.Sprintf("📎(%d) ", nAttachments))
-	} else {
-		s.SetLabel("")
+		label += fmt.Sprintf("📎(%d) ", nAttachments)
 	}
+	s.SetLabel(label)
 	if conv.StagedMessage != "" {
 		s.SetText(conv.StagedMessage)
 	}
 }
 
+// completeMention completes "@Name" from the members of the current group
+func (s *SendPanel) completeMention(input string) []string {
+	s.completing = false
+	contact := s.parent.currentContact
+	if contact == nil || !contact.IsGroup() {
+		return nil
+	}
+	at := strings.LastIndex(input, "@")
+	if at < 0 || (at > 0 && input[at-1] != ' ') {
+		return nil
+	}
+	prefix := strings.ToLower(input[at+1:])
+	entries := make([]string, 0)
+	for _, member := range s.siggo.GroupMembers(contact) {
+		name := member.String()
+		if strings.HasPrefix(strings.ToLower(name), prefix) {
+			entries = append(entries, fmt.Sprintf("%s@%s ", input[:at], name))
+		}
+	}
+	sort.Strings(entries)
+	s.completing = len(entries) > 0
+	return entries
+}
+
 // emojify is a custom input change handler that provides emoji support
 func (s *SendPanel) emojify(input string) {
 	if strings.HasSuffix(input, ":") {
@@ -95,8 +152,14 @@ func NewSendPanel(parent *ChatWindow, siggo *model.Siggo) *SendPanel {
 	s.SetBorder(true)
 	//s.SetFieldBackgroundColor(tcell.ColorDefault)
 	s.SetFieldBackgroundColor(tview.Styles.PrimitiveBackgroundColor)
-	s.SetChangedFunc(s.emojify)
+	s.SetChangedFunc(s.onChanged)
+	s.SetAutocompleteFunc(s.completeMention)
 	s.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if s.completing && (event.Key() == tcell.KeyEnter || event.Key() == tcell.KeyESC) {
+			// let the input field close the mention drop-down
+			s.completing = false
+			return event
+		}
 		switch event.Key() {
 		case tcell.KeyESC:
 			s.Defocus()